@@ -0,0 +1,92 @@
+package sqljs
+
+import (
+	"errors"
+	"io"
+)
+
+// Backend opens the databases used by the driver's connections. The driver
+// depends only on this interface and the interfaces below, so that it may run
+// on SQL.js, or on any other SQLite implementation.
+type Backend interface {
+	// Open opens a database. If r is nil, a new, empty database is created
+	// in memory. Otherwise the database is read from r, which holds an
+	// SQLite database file.
+	Open(r io.Reader) (BackendDatabase, error)
+}
+
+// BackendDatabase is a database opened by a Backend.
+type BackendDatabase interface {
+	// Prepare compiles a single SQL statement.
+	Prepare(query string) (BackendStatement, error)
+	// Run executes one or more SQL statements, separated by ';', ignoring
+	// any rows they return.
+	Run(query string) error
+	// RowsModified returns the number of rows modified, inserted or deleted
+	// by the most recently completed INSERT, UPDATE or DELETE statement.
+	RowsModified() int64
+	// Export returns the contents of the database, as an SQLite database
+	// file.
+	Export() (io.Reader, error)
+	// Close closes the database, and frees its prepared statements.
+	Close() error
+}
+
+// BackendStatement is a statement prepared by a BackendDatabase.
+//
+// The driver also uses the following methods when a statement provides them:
+//
+//    IsReadOnly() (bool, error)          // required by SQLJSDriver.ReadOnly
+//    ExpandedSQL() (string, error)       // passed to SQLJSDriver.Trace
+//    ParameterNames() ([]string, error)  // for database/sql argument checks
+//    ColumnDeclTypes() ([]string, error) // for ColumnTypeDatabaseTypeName()
+type BackendStatement interface {
+	// Bind resets the statement, and binds params to its placeholders.
+	Bind(params []interface{}) error
+	// Step advances to the next row of the result, returning false when
+	// there are no more rows.
+	Step() (bool, error)
+	// Get returns the values of the current row. Each value is nil, an
+	// int64, a float64, a string or a []byte.
+	Get() ([]interface{}, error)
+	// ColumnNames returns the names of the result columns.
+	ColumnNames() ([]string, error)
+	// Exec binds params, runs the statement to completion, and resets it.
+	Exec(params []interface{}) error
+	// Reset resets the statement, so that it may be executed again.
+	Reset() error
+	// Free frees the statement.
+	Free() error
+}
+
+// ErrReadOnlyUnsupported is returned when preparing a statement on a
+// read-only connection whose backend cannot tell whether a statement is
+// read-only.
+var ErrReadOnlyUnsupported = errors.New("backend cannot check for read-only statements")
+
+func isReadOnly(s BackendStatement) (bool, error) {
+	if ro, ok := s.(interface {
+		IsReadOnly() (bool, error)
+	}); ok {
+		return ro.IsReadOnly()
+	}
+	return false, ErrReadOnlyUnsupported
+}
+
+func expandedSQL(s BackendStatement) (string, error) {
+	if ex, ok := s.(interface {
+		ExpandedSQL() (string, error)
+	}); ok {
+		return ex.ExpandedSQL()
+	}
+	return "", errors.New("backend cannot expand SQL")
+}
+
+func columnDeclTypes(s BackendStatement) ([]string, error) {
+	if dt, ok := s.(interface {
+		ColumnDeclTypes() ([]string, error)
+	}); ok {
+		return dt.ColumnDeclTypes()
+	}
+	return nil, errors.New("backend cannot report declared types")
+}
@@ -0,0 +1,310 @@
+// +build !js
+
+package sqljs
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flimzy/go-sql.js/bindings"
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// NativeBackend is a Backend which stores databases with a native SQLite
+// driver for database/sql, such as github.com/mattn/go-sqlite3, which the
+// application must import itself. It is the default backend outside of
+// GopherJS, so that code using this driver can be built and tested with the
+// standard Go toolchain:
+//
+//    import _ "github.com/mattn/go-sqlite3"
+//
+//    db, err := sql.Open("sqljs", "")
+//
+// Errors are reported as *Error values, with result codes inferred from their
+// messages. Exporting a database requires SQLite 3.27 or later.
+//
+// Drivers such as github.com/mattn/go-sqlite3 read the values of DATE,
+// DATETIME and TIMESTAMP columns as time.Time. They are converted back to text
+// in the format of SQLite's date and time functions, such as
+// "2021-06-01 12:30:00", or "2021-06-01" for a date in a DATE column, and
+// times bound as parameters are stored in the same format, so that such
+// values read back as they were stored. Text in other formats, such as
+// RFC 3339, may be read back in this format instead.
+type NativeBackend struct {
+	// DriverName is the name under which the native SQLite driver is
+	// registered. If empty, "sqlite3" or "sqlite" is used, whichever is
+	// registered.
+	DriverName string
+}
+
+var defaultBackend Backend = NativeBackend{}
+
+// setup does nothing, as the driver's SQL.js options do not apply to other
+// backends.
+func (d *SQLJSDriver) setup(db BackendDatabase) error {
+	return nil
+}
+
+// ErrNoNativeDriver is returned by NativeBackend when no native SQLite driver
+// has been registered.
+var ErrNoNativeDriver = errors.New("no native SQLite driver is registered; import one, such as github.com/mattn/go-sqlite3")
+
+func (b NativeBackend) driverName() (string, error) {
+	if b.DriverName != "" {
+		return b.DriverName, nil
+	}
+	for _, name := range []string{"sqlite3", "sqlite"} {
+		for _, registered := range sql.Drivers() {
+			if name == registered {
+				return name, nil
+			}
+		}
+	}
+	return "", ErrNoNativeDriver
+}
+
+// Open opens a new in-memory database. If r is not nil, its contents are
+// copied to a temporary file, which is opened instead, and removed when the
+// database is closed.
+func (b NativeBackend) Open(r io.Reader) (BackendDatabase, error) {
+	name, err := b.driverName()
+	if err != nil {
+		return nil, err
+	}
+	d := &nativeDatabase{}
+	dsn := ":memory:"
+	if r != nil {
+		f, err := ioutil.TempFile("", "sqljs-*.db")
+		if err != nil {
+			return nil, err
+		}
+		d.path = f.Name()
+		_, err = io.Copy(f, r)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(d.path)
+			return nil, err
+		}
+		dsn = d.path
+	}
+	if d.db, err = sql.Open(name, dsn); err == nil {
+		// An in-memory database exists only as long as its connection, so
+		// a single connection is held for the life of the database.
+		d.conn, err = d.db.Conn(context.Background())
+	}
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+type nativeDatabase struct {
+	db   *sql.DB
+	conn *sql.Conn
+	path string // The temporary file holding the database, if any
+}
+
+// nativeError converts an error reported by the native driver to an *Error.
+func nativeError(query string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return bindings.ErrorFromMessage(query, err.Error())
+}
+
+func (d *nativeDatabase) Prepare(query string) (BackendStatement, error) {
+	s, err := d.conn.PrepareContext(context.Background(), query)
+	if err != nil {
+		return nil, nativeError(query, err)
+	}
+	return &nativeStatement{stmt: s, text: query}, nil
+}
+
+func (d *nativeDatabase) Run(query string) error {
+	_, err := d.conn.ExecContext(context.Background(), query)
+	return nativeError(query, err)
+}
+
+func (d *nativeDatabase) RowsModified() int64 {
+	var n int64
+	d.conn.QueryRowContext(context.Background(), "SELECT changes()").Scan(&n)
+	return n
+}
+
+// Export copies the database with VACUUM INTO, and returns the copy.
+func (d *nativeDatabase) Export() (io.Reader, error) {
+	dir, err := ioutil.TempDir("", "sqljs-export")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "export.db")
+	if err := d.Run("VACUUM INTO " + script.Literal(path)); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (d *nativeDatabase) Close() error {
+	var err error
+	if d.conn != nil {
+		err = d.conn.Close()
+	}
+	if d.db != nil {
+		if cerr := d.db.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if d.path != "" {
+		os.Remove(d.path)
+	}
+	return err
+}
+
+// nativeStatement runs a prepared statement as a query when it is first
+// stepped, and reads its rows from the resulting *sql.Rows.
+type nativeStatement struct {
+	stmt *sql.Stmt
+	text string
+	args []interface{}
+	rows *sql.Rows
+}
+
+func (s *nativeStatement) query() error {
+	if s.rows != nil {
+		return nil
+	}
+	rows, err := s.stmt.QueryContext(context.Background(), nativeArgs(s.args)...)
+	if err != nil {
+		return nativeError(s.text, err)
+	}
+	s.rows = rows
+	return nil
+}
+
+func (s *nativeStatement) Bind(params []interface{}) error {
+	s.Reset()
+	s.args = params
+	return nil
+}
+
+func (s *nativeStatement) Step() (bool, error) {
+	if err := s.query(); err != nil {
+		return false, err
+	}
+	if s.rows.Next() {
+		return true, nil
+	}
+	return false, nativeError(s.text, s.rows.Err())
+}
+
+func (s *nativeStatement) Get() ([]interface{}, error) {
+	if s.rows == nil {
+		return nil, errors.New("no current row")
+	}
+	cols, err := s.rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range dest {
+		dest[i] = &values[i]
+	}
+	if err := s.rows.Scan(dest...); err != nil {
+		return nil, nativeError(s.text, err)
+	}
+	for i, v := range values {
+		switch t := v.(type) {
+		case bool:
+			if t {
+				values[i] = int64(1)
+			} else {
+				values[i] = int64(0)
+			}
+		case int:
+			values[i] = int64(t)
+		case time.Time:
+			var decl string
+			if types, err := s.rows.ColumnTypes(); err == nil {
+				decl = types[i].DatabaseTypeName()
+			}
+			values[i] = timeText(t, decl)
+		}
+	}
+	return values, nil
+}
+
+// timeText converts a time read by the native driver from a column declared
+// as decl back to text, in the format of SQLite's date and time functions.
+func timeText(t time.Time, decl string) string {
+	h, m, sec := t.Clock()
+	switch {
+	case strings.EqualFold(decl, "DATE") && h == 0 && m == 0 && sec == 0 && t.Nanosecond() == 0:
+		return t.Format("2006-01-02")
+	case t.Location() == time.UTC:
+		return t.Format("2006-01-02 15:04:05.999999999")
+	}
+	return t.Format("2006-01-02 15:04:05.999999999-07:00")
+}
+
+// nativeArgs converts the times in params to text, in the format in which
+// they are read back, as the native driver would otherwise store them in a
+// format of its own.
+func nativeArgs(params []interface{}) []interface{} {
+	var args []interface{}
+	for i, v := range params {
+		if t, ok := v.(time.Time); ok {
+			if args == nil {
+				args = append([]interface{}(nil), params...)
+			}
+			args[i] = timeText(t, "")
+		}
+	}
+	if args == nil {
+		return params
+	}
+	return args
+}
+
+func (s *nativeStatement) ColumnNames() ([]string, error) {
+	if err := s.query(); err != nil {
+		return nil, err
+	}
+	return s.rows.Columns()
+}
+
+func (s *nativeStatement) Exec(params []interface{}) error {
+	s.Reset()
+	_, err := s.stmt.ExecContext(context.Background(), nativeArgs(params)...)
+	return nativeError(s.text, err)
+}
+
+func (s *nativeStatement) Reset() error {
+	if s.rows == nil {
+		return nil
+	}
+	err := s.rows.Close()
+	s.rows = nil
+	return err
+}
+
+func (s *nativeStatement) Free() error {
+	s.Reset()
+	return s.stmt.Close()
+}
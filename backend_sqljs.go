@@ -0,0 +1,94 @@
+// +build js
+
+package sqljs
+
+import (
+	"errors"
+	"io"
+
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+// SQLJSBackend is the Backend which runs databases in SQL.js, through the
+// bindings package. It is the default backend of GopherJS builds.
+type SQLJSBackend struct{}
+
+var defaultBackend Backend = SQLJSBackend{}
+
+// setup applies the driver's SQL.js options to a database opened by
+// SQLJSBackend.
+func (d *SQLJSDriver) setup(bdb BackendDatabase) error {
+	db, ok := bdb.(*sqljsDatabase)
+	if !ok {
+		return nil
+	}
+	db.SetDebug(d.ReportLeaks)
+	db.SetJournal(d.Journal)
+	if d.ConnectHook != nil {
+		return d.ConnectHook(db.Database)
+	}
+	return nil
+}
+
+// Open opens a new SQL.js database, reading its contents from r if it is not
+// nil.
+func (SQLJSBackend) Open(r io.Reader) (BackendDatabase, error) {
+	if r == nil {
+		return &sqljsDatabase{bindings.New()}, nil
+	}
+	return &sqljsDatabase{bindings.OpenReader(r)}, nil
+}
+
+// Database returns the SQL.js database of the connection, or nil if the
+// connection uses another backend.
+func (c *SQLJSConn) Database() *bindings.Database {
+	if db, ok := c.db.(*sqljsDatabase); ok {
+		return db.Database
+	}
+	return nil
+}
+
+type sqljsDatabase struct {
+	*bindings.Database
+}
+
+func (d *sqljsDatabase) Prepare(query string) (BackendStatement, error) {
+	s, err := d.Database.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	s.SetIntegerMode(bindings.Int64Integers)
+	return &sqljsStatement{s}, nil
+}
+
+func (d *sqljsDatabase) RowsModified() int64 {
+	return d.GetRowsModified()
+}
+
+func (d *sqljsDatabase) Export() (io.Reader, error) {
+	return d.Database.Export(), nil
+}
+
+type sqljsStatement struct {
+	*bindings.Statement
+}
+
+func (s *sqljsStatement) ColumnNames() ([]string, error) {
+	return s.GetColumnNames()
+}
+
+func (s *sqljsStatement) Exec(params []interface{}) error {
+	return s.RunParams(params)
+}
+
+func (s *sqljsStatement) Reset() error {
+	s.Statement.Reset()
+	return nil
+}
+
+func (s *sqljsStatement) Free() error {
+	if !s.Statement.Free() {
+		return errors.New("Error freeing statement memory")
+	}
+	return nil
+}
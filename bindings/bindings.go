@@ -0,0 +1,49 @@
+// Package bindings provides minimal GopherJS bindings around the SQL.js (https://github.com/lovasoa/sql.js)
+//
+// The bindings are also built for Go WebAssembly (GOOS=js GOARCH=wasm), on
+// syscall/js, with the same API. Where the GopherJS build exposes a
+// *js.Object, the WebAssembly build exposes a js.Value.
+package bindings
+
+import (
+	"errors"
+)
+
+// IntegerMode determines how INTEGER values are returned by a Database and its
+// statements.
+type IntegerMode int
+
+const (
+	// Float64Integers returns INTEGER values as float64, as SQL.js does by
+	// default. Values beyond 2^53 lose precision.
+	Float64Integers IntegerMode = iota
+	// Int64Integers returns INTEGER values as exact int64 values.
+	Int64Integers
+)
+
+type Result struct {
+	Columns []string
+	Values  [][]interface{}
+}
+
+// LiveStatement describes a prepared statement which has not been freed.
+type LiveStatement struct {
+	// SQL is the text of the statement.
+	SQL string
+	// Stack is the stack trace of the goroutine which prepared the
+	// statement. It is only recorded in debug mode.
+	Stack string
+
+	id int
+}
+
+// Function is the implementation of an SQL function. Arguments are passed
+// as nil, float64, int64 (for integers beyond 2^53), string or []byte. The
+// result may be nil, a bool, any integer or float type, a string or a
+// []byte. A returned error is reported to SQLite as the result of the
+// function, causing the statement to fail.
+type Function func(args []interface{}) (interface{}, error)
+
+// ErrWorkerClosed is returned by the methods of a WorkerDatabase which has
+// been closed, or whose worker has failed.
+var ErrWorkerClosed = errors.New("worker is closed")
@@ -0,0 +1,68 @@
+// +build js
+
+package bindings
+
+import (
+	"fmt"
+)
+
+// captureError calls fn, and returns any panic which occurs as an error.
+func captureError(fn func()) (e error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch err := r.(type) {
+			case error:
+				e = err
+			default:
+				e = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	fn()
+	return nil
+}
+
+// captureError calls fn, and converts any JavaScript exception raised by
+// SQL.js into an *Error for the passed SQL.
+func (d *Database) captureError(query string, fn func()) error {
+	err := captureError(fn)
+	exception, ok := thrown(err)
+	if !ok {
+		return err
+	}
+	e := &Error{
+		Code:    ErrError.Code,
+		Message: errorMessage(exception),
+		SQL:     query,
+		Offset:  -1,
+	}
+	if code, err := d.call("sqlite3_errcode", "number"); err == nil && code.Int() != 0 {
+		e.Code = code.Int()
+		e.ExtendedCode = e.Code
+		if code, err := d.call("sqlite3_extended_errcode", "number"); err == nil {
+			e.ExtendedCode = code.Int()
+		}
+	} else {
+		e.codeFromMessage()
+	}
+	if e.ExtendedCode == 0 {
+		e.ExtendedCode = e.Code
+	}
+	if offset, err := d.call("sqlite3_error_offset", "number"); err == nil {
+		e.Offset = offset.Int()
+	}
+	return e
+}
+
+// captureError calls fn, and converts any JavaScript exception raised by
+// SQL.js into an *Error for the statement's SQL.
+func (s *Statement) captureError(fn func()) error {
+	if s.db == nil {
+		return captureError(fn)
+	}
+	var query string
+	captureError(func() {
+		query = s.SQL()
+	})
+	return s.db.captureError(query, fn)
+}
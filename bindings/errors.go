@@ -0,0 +1,126 @@
+package bindings
+
+import (
+	"strings"
+)
+
+// Error is an error reported by SQLite.
+type Error struct {
+	// Code is the primary result code, such as 19 (SQLITE_CONSTRAINT).
+	Code int
+	// ExtendedCode is the extended result code, such as 2067
+	// (SQLITE_CONSTRAINT_UNIQUE). It equals Code when no extended code is
+	// known.
+	ExtendedCode int
+	// Message is the English-language error message.
+	Message string
+	// SQL is the text of the statement which caused the error, if known.
+	SQL string
+	// Offset is the byte offset of the token which caused the error, within
+	// the text of the failing statement, or -1 if not known.
+	Offset int
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is an *Error with the same result code. If the
+// target has an extended result code, the extended codes are compared.
+// This allows checking errors against the sentinel values with errors.Is().
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.ExtendedCode != t.Code {
+		return e.ExtendedCode == t.ExtendedCode
+	}
+	return e.Code == t.Code
+}
+
+func sentinel(code, extended int, msg string) *Error {
+	return &Error{Code: code, ExtendedCode: extended, Message: msg, Offset: -1}
+}
+
+// Sentinel errors, for use with errors.Is(). Only the result codes are
+// compared.
+//
+// See https://www.sqlite.org/rescode.html
+var (
+	ErrError      = sentinel(1, 1, "SQL logic error")
+	ErrInternal   = sentinel(2, 2, "internal logic error")
+	ErrPerm       = sentinel(3, 3, "access permission denied")
+	ErrAbort      = sentinel(4, 4, "query aborted")
+	ErrBusy       = sentinel(5, 5, "database is locked")
+	ErrLocked     = sentinel(6, 6, "database table is locked")
+	ErrNoMem      = sentinel(7, 7, "out of memory")
+	ErrReadOnly   = sentinel(8, 8, "attempt to write a readonly database")
+	ErrInterrupt  = sentinel(9, 9, "interrupted")
+	ErrIOErr      = sentinel(10, 10, "disk I/O error")
+	ErrCorrupt    = sentinel(11, 11, "database disk image is malformed")
+	ErrNotFound   = sentinel(12, 12, "unknown operation")
+	ErrFull       = sentinel(13, 13, "database or disk is full")
+	ErrCantOpen   = sentinel(14, 14, "unable to open database file")
+	ErrProtocol   = sentinel(15, 15, "locking protocol")
+	ErrSchema     = sentinel(17, 17, "database schema has changed")
+	ErrTooBig     = sentinel(18, 18, "string or blob too big")
+	ErrConstraint = sentinel(19, 19, "constraint failed")
+	ErrMismatch   = sentinel(20, 20, "datatype mismatch")
+	ErrMisuse     = sentinel(21, 21, "bad parameter or other API misuse")
+	ErrRange      = sentinel(25, 25, "column index out of range")
+	ErrNotADB     = sentinel(26, 26, "file is not a database")
+
+	ErrConstraintCheck      = sentinel(19, 275, "CHECK constraint failed")
+	ErrConstraintForeignKey = sentinel(19, 787, "FOREIGN KEY constraint failed")
+	ErrConstraintNotNull    = sentinel(19, 1299, "NOT NULL constraint failed")
+	ErrConstraintPrimaryKey = sentinel(19, 1555, "PRIMARY KEY constraint failed")
+	ErrConstraintTrigger    = sentinel(19, 1811, "constraint failed")
+	ErrConstraintUnique     = sentinel(19, 2067, "UNIQUE constraint failed")
+)
+
+// ErrorFromMessage returns an *Error for an error message reported by SQLite
+// for query, whose result codes are inferred from the message. It is intended
+// for backends which report errors only as text.
+func ErrorFromMessage(query, message string) *Error {
+	e := &Error{Code: ErrError.Code, Message: message, SQL: query, Offset: -1}
+	e.codeFromMessage()
+	if e.ExtendedCode == 0 {
+		e.ExtendedCode = e.Code
+	}
+	return e
+}
+
+// codeFromMessage sets the result codes of e from its message, for when the
+// SQLite error code functions are not available.
+func (e *Error) codeFromMessage() {
+	for _, known := range messageCodes {
+		if strings.HasPrefix(e.Message, known.Message) {
+			e.Code, e.ExtendedCode = known.Code, known.ExtendedCode
+			return
+		}
+	}
+}
+
+// messageCodes maps error messages to result codes, for when the SQLite error
+// code functions are not exported by SQL.js. They are checked in order.
+var messageCodes = []*Error{
+	ErrConstraintUnique,
+	ErrConstraintNotNull,
+	ErrConstraintCheck,
+	ErrConstraintForeignKey,
+	ErrConstraintPrimaryKey,
+	ErrConstraint,
+	ErrBusy,
+	ErrLocked,
+	ErrNoMem,
+	ErrReadOnly,
+	ErrInterrupt,
+	ErrCorrupt,
+	ErrFull,
+	ErrTooBig,
+	ErrMismatch,
+	ErrMisuse,
+	ErrRange,
+	ErrNotADB,
+}
@@ -0,0 +1,52 @@
+// +build js
+
+package bindings
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CreateFunction registers a scalar SQL function taking nArg arguments,
+// replacing any previous function of the same name, including built-in
+// functions. SQL.js allows only one function of a given name, so the
+// function cannot be overloaded by number of arguments.
+//
+// The function is never released, as SQL.js may call it for as long as the
+// database is open.
+//
+// See https://sql.js.org/documentation/Database.html#["create_function"]
+func (d *Database) CreateFunction(name string, nArg int, fn Function) error {
+	if nArg < 0 {
+		return errors.New("variadic functions are not supported")
+	}
+	// A panic cannot cross from a Go callback into JavaScript under
+	// WebAssembly, so errors are returned to the wrapper below, which throws
+	// them.
+	impl, _ := newFunc(func(arguments []jsObject) interface{} {
+		args := make([]interface{}, len(arguments))
+		for i, a := range arguments {
+			args[i] = goValue(a)
+		}
+		result, err := fn(args)
+		if err != nil {
+			return map[string]interface{}{"error": fmt.Sprintf("%s: %s", name, err)}
+		}
+		return map[string]interface{}{"value": jsValue(result)}
+	})
+	// SQL.js takes the number of arguments from the function's length,
+	// so wrap the implementation in a function with nArg parameters.
+	params := make([]string, nArg)
+	for i := range params {
+		params[i] = fmt.Sprintf("a%d", i)
+	}
+	wrap := global().Get("Function").New("impl",
+		"return function("+strings.Join(params, ", ")+") { "+
+			"var r = impl.apply(null, arguments); "+
+			"if (r.error !== undefined) { throw new Error(r.error); } "+
+			"return r.value; };")
+	return d.captureError("", func() {
+		d.Call("create_function", name, wrap.Invoke(impl))
+	})
+}
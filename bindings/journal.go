@@ -0,0 +1,277 @@
+// +build js
+
+package bindings
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// SetJournal enables journaling: every mutating statement executed with
+// Run(), RunParams(), or the methods of a Statement, is appended to w along
+// with its parameters, once it has executed successfully. A statement which
+// is stepped, such as an INSERT ... RETURNING, is journaled by its first
+// Step() after being bound or reset. Statements executed with Exec() are not
+// journaled. Transaction control statements, such as BEGIN and ROLLBACK, are
+// journaled too, so that replaying the journal with Replay() rebuilds the
+// same database. The statements of a script passed to Run() are executed and
+// journaled one at a time, so that if one fails, those before it are still
+// journaled. Passing nil disables journaling.
+//
+// Each entry is a JSON object on a line of its own. "q" holds the SQL text,
+// and "p" the positional parameters, or "n" the named parameters, if any.
+// Integers are written as JSON integers, and floats always contain a
+// decimal point or exponent. BLOBs are written as {"b": "<base64>"}, and
+// infinite and NaN floats as {"f": "+Inf"}, {"f": "-Inf"} or {"f": "NaN"}.
+//
+//    {"q":"CREATE TABLE t (x, y)"}
+//    {"q":"INSERT INTO t VALUES (?, ?)","p":[1,{"b":"AP8="}]}
+//    {"q":"UPDATE t SET y = :y","n":{":y":2.5}}
+//
+// If writing an entry fails, the statement has still been executed, and the
+// write error is returned.
+func (d *Database) SetJournal(w io.Writer) {
+	d.journal = w
+}
+
+// Journal returns the writer set with SetJournal(), or nil.
+func (d *Database) Journal() io.Writer {
+	return d.journal
+}
+
+type journalEntry struct {
+	Query  string                 `json:"q"`
+	Params []interface{}          `json:"p,omitempty"`
+	Named  map[string]interface{} `json:"n,omitempty"`
+}
+
+// mutating reports whether the statement should be journaled. Transaction
+// control statements are journaled although SQLite reports them as read-only.
+func (s *Statement) mutating() bool {
+	ro, err := s.IsReadOnly()
+	if err != nil || !ro {
+		return true
+	}
+	switch script.Keyword(s.SQL()) {
+	case "BEGIN", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE":
+		return true
+	}
+	return false
+}
+
+// journalStep journals the statement when it is first stepped after being
+// bound or reset, as SQLite makes all of a statement's changes, including
+// those of an INSERT ... RETURNING, by its first step.
+func (s *Statement) journalStep() error {
+	if s.stepped {
+		return nil
+	}
+	s.stepped = true
+	if s.db == nil || s.db.journal == nil || !s.mutating() {
+		return nil
+	}
+	return s.db.writeJournal(strings.TrimSpace(s.SQL()), s.params)
+}
+
+// boundAndStepped journals the statement after a call which bound params and
+// stepped it within SQL.js, such as GetParams(), unless the call failed with
+// *e.
+func (s *Statement) boundAndStepped(params interface{}, e *error) {
+	if *e != nil {
+		return
+	}
+	s.params, s.stepped = params, false
+	*e = s.journalStep()
+}
+
+// runJournaled executes the statements of a script one at a time, so that
+// each is journaled once it has executed, and the journal still matches the
+// database if a later statement fails.
+func (d *Database) runJournaled(query string) error {
+	it, err := d.IterateStatements(query)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		if err := it.Statement().Run(); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func (d *Database) writeJournal(query string, params interface{}) error {
+	entry := journalEntry{Query: query}
+	switch p := params.(type) {
+	case []interface{}:
+		entry.Params = make([]interface{}, len(p))
+		for i, v := range p {
+			entry.Params[i] = journalValue(v)
+		}
+	case map[string]interface{}:
+		entry.Named = make(map[string]interface{}, len(p))
+		for k, v := range p {
+			entry.Named[k] = journalValue(v)
+		}
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	if _, err := d.journal.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	return nil
+}
+
+type journalBlob struct {
+	B []byte `json:"b"`
+}
+
+type journalFloat struct {
+	F string `json:"f"`
+}
+
+// journalValue converts a parameter to its journal representation.
+func journalValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil, bool, string:
+		return v
+	case time.Time:
+		return timeValue(t)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return json.Number(strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return json.Number(strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		switch {
+		case math.IsInf(f, 1):
+			return journalFloat{"+Inf"}
+		case math.IsInf(f, -1):
+			return journalFloat{"-Inf"}
+		case math.IsNaN(f):
+			return journalFloat{"NaN"}
+		}
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return json.Number(s)
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return journalBlob{rv.Bytes()}
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// paramValue converts a value read from a journal to a parameter.
+func paramValue(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case json.Number:
+		s := t.String()
+		if !strings.ContainsAny(s, ".eE") {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+			if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+				return u, nil
+			}
+		}
+		return t.Float64()
+	case map[string]interface{}:
+		if b, ok := t["b"].(string); ok {
+			return base64.StdEncoding.DecodeString(b)
+		}
+		if f, ok := t["f"].(string); ok {
+			return strconv.ParseFloat(f, 64)
+		}
+		return nil, fmt.Errorf("invalid value %v", t)
+	}
+	return v, nil
+}
+
+// ReplayError is returned by Replay when an entry cannot be replayed.
+type ReplayError struct {
+	// Entry is the 1-based number of the entry.
+	Entry int
+	Query string
+	Err   error
+}
+
+func (e *ReplayError) Error() string {
+	return fmt.Sprintf("journal entry %d: %s", e.Entry, e.Err)
+}
+
+func (e *ReplayError) Unwrap() error {
+	return e.Err
+}
+
+// Replay executes the statements recorded in a journal written by a
+// database with journaling enabled, in order. Replaying a complete journal
+// into a new database rebuilds the database which wrote it.
+func Replay(journal io.Reader, db *Database) error {
+	dec := json.NewDecoder(bufio.NewReader(journal))
+	dec.UseNumber()
+	for n := 1; ; n++ {
+		var entry journalEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return &ReplayError{Entry: n, Err: err}
+		}
+		if err := replayEntry(db, entry); err != nil {
+			return &ReplayError{Entry: n, Query: entry.Query, Err: err}
+		}
+	}
+}
+
+func replayEntry(db *Database, entry journalEntry) error {
+	switch {
+	case entry.Named != nil:
+		params := make(map[string]interface{}, len(entry.Named))
+		for k, v := range entry.Named {
+			p, err := paramValue(v)
+			if err != nil {
+				return err
+			}
+			params[k] = p
+		}
+		s, err := db.Prepare(entry.Query)
+		if err != nil {
+			return err
+		}
+		defer s.Free()
+		return s.RunNamedParams(params)
+	case entry.Params != nil:
+		params := make([]interface{}, len(entry.Params))
+		for i, v := range entry.Params {
+			p, err := paramValue(v)
+			if err != nil {
+				return err
+			}
+			params[i] = p
+		}
+		return db.RunParams(entry.Query, params)
+	}
+	return db.Run(entry.Query)
+}
@@ -0,0 +1,158 @@
+// +build js,!wasm
+
+package bindings
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/gopherjs/gopherjs/js"
+)
+
+// jsObject is a JavaScript value. The rest of the package uses only the
+// methods which *js.Object and syscall/js's js.Value have in common, and the
+// helpers below, so that it builds both with GopherJS and for WebAssembly.
+type jsObject = *js.Object
+
+type Database struct {
+	*js.Object
+	integerMode IntegerMode
+	statements  statementRegistry
+	journal     io.Writer
+}
+
+type Statement struct {
+	*js.Object
+	db     *Database
+	id     int
+	offset int
+	int64  bool
+	// params are the parameters last bound, and stepped reports whether
+	// the statement has been stepped since, for journaling.
+	params  interface{}
+	stepped bool
+}
+
+// StatementIterator iterates over the statements of an SQL script, preparing
+// one statement at a time. It is returned by Database.IterateStatements().
+type StatementIterator struct {
+	*js.Object
+	sql    string
+	offset int
+	stmt   *Statement
+	err    error
+	db     *Database
+	done   bool // The script is exhausted, or the iterator closed
+}
+
+// object returns the SQL.js Database object wrapped by d.
+func (d *Database) object() jsObject {
+	return d.Object
+}
+
+// object returns the SQL.js Statement object wrapped by s.
+func (s *Statement) object() jsObject {
+	return s.Object
+}
+
+func newDatabase(o jsObject) *Database {
+	return &Database{Object: o}
+}
+
+func newStatement(o jsObject) *Statement {
+	return &Statement{Object: o}
+}
+
+func newIterator(o jsObject) *StatementIterator {
+	return &StatementIterator{Object: o}
+}
+
+// undefined is the JavaScript undefined value.
+var undefined = js.Undefined
+
+func global() jsObject {
+	return js.Global
+}
+
+// isNil reports whether o is undefined or null.
+func isNil(o jsObject) bool {
+	return o == nil || o == js.Undefined
+}
+
+// newFunc returns a JavaScript function which calls fn, and a function which
+// releases it once it is no longer needed.
+func newFunc(fn func(args []jsObject) interface{}) (jsObject, func()) {
+	return js.MakeFunc(func(this *js.Object, args []*js.Object) interface{} {
+		return fn(args)
+	}), func() {}
+}
+
+// thrown returns the value thrown by JavaScript, if err is a JavaScript
+// exception.
+func thrown(err error) (jsObject, bool) {
+	if jsErr, ok := err.(*js.Error); ok {
+		return jsErr.Object, true
+	}
+	return nil, false
+}
+
+// errorMessage returns the message of a JavaScript exception, which SQL.js
+// may throw either as an Error or as a string.
+func errorMessage(o jsObject) string {
+	if !isNil(o) && o.Get("message") != js.Undefined {
+		return o.Get("message").String()
+	}
+	return js.Global.Call("String", o).String()
+}
+
+// finalizer is the FinalizationRegistry which frees abandoned statements, or
+// nil if it has not been created yet.
+var finalizer *js.Object
+
+// setFinalizer arranges for cleanup to be called when s is garbage collected,
+// if the JavaScript runtime supports FinalizationRegistry.
+func setFinalizer(s *Statement, cleanup func()) {
+	if finalizer == nil {
+		registry := js.Global.Get("FinalizationRegistry")
+		if registry == js.Undefined {
+			return
+		}
+		finalizer = registry.New(func(cleanup func()) {
+			cleanup()
+		})
+	}
+	finalizer.Call("register", js.InternalObject(s), cleanup, js.InternalObject(s))
+}
+
+// clearFinalizer cancels the cleanup set by setFinalizer.
+func clearFinalizer(s *Statement) {
+	if finalizer != nil {
+		finalizer.Call("unregister", js.InternalObject(s))
+	}
+}
+
+// uint8Array copies b into a new Uint8Array.
+func uint8Array(b []byte) jsObject {
+	return js.Global.Get("Uint8Array").New(js.NewArrayBuffer(b))
+}
+
+// goValue converts a value returned by SQL.js into its Go equivalent. BLOBs
+// are always returned as []byte, whatever kind of typed array (including
+// node.js Buffers) SQL.js produced.
+func goValue(o jsObject) interface{} {
+	if isNil(o) {
+		return nil
+	}
+	if bigInt := js.Global.Get("BigInt"); bigInt != js.Undefined && o.Get("constructor") == bigInt {
+		i, err := strconv.ParseInt(o.Call("toString").String(), 10, 64)
+		if err != nil {
+			panic(err)
+		}
+		return i
+	}
+	if js.Global.Get("ArrayBuffer").Call("isView", o).Bool() {
+		b := js.Global.Get("Uint8Array").New(o.Get("buffer"), o.Get("byteOffset"), o.Get("byteLength"))
+		return append([]byte{}, b.Interface().([]byte)...)
+	}
+	return o.Interface()
+}
@@ -0,0 +1,168 @@
+// +build js,wasm
+
+package bindings
+
+import (
+	"io"
+	"runtime"
+	"strconv"
+	"syscall/js"
+)
+
+// jsObject is a JavaScript value. The rest of the package uses only the
+// methods which *js.Object and syscall/js's js.Value have in common, and the
+// helpers below, so that it builds both with GopherJS and for WebAssembly.
+type jsObject = js.Value
+
+type Database struct {
+	js.Value
+	integerMode IntegerMode
+	statements  statementRegistry
+	journal     io.Writer
+}
+
+type Statement struct {
+	js.Value
+	db     *Database
+	id     int
+	offset int
+	int64  bool
+	// params are the parameters last bound, and stepped reports whether
+	// the statement has been stepped since, for journaling.
+	params  interface{}
+	stepped bool
+}
+
+// StatementIterator iterates over the statements of an SQL script, preparing
+// one statement at a time. It is returned by Database.IterateStatements().
+type StatementIterator struct {
+	js.Value
+	sql    string
+	offset int
+	stmt   *Statement
+	err    error
+	db     *Database
+	done   bool // The script is exhausted, or the iterator closed
+}
+
+// object returns the SQL.js Database object wrapped by d.
+func (d *Database) object() jsObject {
+	return d.Value
+}
+
+// object returns the SQL.js Statement object wrapped by s.
+func (s *Statement) object() jsObject {
+	return s.Value
+}
+
+func newDatabase(o jsObject) *Database {
+	return &Database{Value: o}
+}
+
+func newStatement(o jsObject) *Statement {
+	return &Statement{Value: o}
+}
+
+func newIterator(o jsObject) *StatementIterator {
+	return &StatementIterator{Value: o}
+}
+
+// undefined is the JavaScript undefined value.
+var undefined = js.Undefined()
+
+func global() jsObject {
+	return js.Global()
+}
+
+// isNil reports whether o is undefined or null.
+func isNil(o jsObject) bool {
+	return o.IsUndefined() || o.IsNull()
+}
+
+// newFunc returns a JavaScript function which calls fn, and a function which
+// releases it once it is no longer needed.
+func newFunc(fn func(args []jsObject) interface{}) (jsObject, func()) {
+	f := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return fn(args)
+	})
+	return f.Value, f.Release
+}
+
+// thrown returns the value thrown by JavaScript, if err is a JavaScript
+// exception.
+func thrown(err error) (jsObject, bool) {
+	if jsErr, ok := err.(js.Error); ok {
+		return jsErr.Value, true
+	}
+	return undefined, false
+}
+
+// errorMessage returns the message of a JavaScript exception, which SQL.js
+// may throw either as an Error or as a string.
+func errorMessage(o jsObject) string {
+	if typeOf.Invoke(o).String() == "object" && !o.IsNull() {
+		if msg := o.Get("message"); !msg.IsUndefined() {
+			return msg.String()
+		}
+	}
+	return jsString(o)
+}
+
+// setFinalizer arranges for cleanup to be called when s is garbage collected.
+func setFinalizer(s *Statement, cleanup func()) {
+	runtime.SetFinalizer(s, func(*Statement) {
+		cleanup()
+	})
+}
+
+// clearFinalizer cancels the cleanup set by setFinalizer.
+func clearFinalizer(s *Statement) {
+	runtime.SetFinalizer(s, nil)
+}
+
+// uint8Array copies b into a new Uint8Array.
+func uint8Array(b []byte) jsObject {
+	array := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(array, b)
+	return array
+}
+
+// typeOf is the JavaScript typeof operator. It is needed because
+// js.Value.Type() panics on BigInts.
+var typeOf = js.Global().Get("Function").New("v", "return typeof v;")
+
+// jsString converts any JavaScript value, including a BigInt, to a string.
+func jsString(v js.Value) string {
+	return js.Global().Get("String").Invoke(v).String()
+}
+
+// goValue converts a value returned by SQL.js into its Go equivalent. BLOBs
+// are always returned as []byte, whatever kind of typed array (including
+// node.js Buffers) SQL.js produced.
+func goValue(o jsObject) interface{} {
+	switch typeOf.Invoke(o).String() {
+	case "undefined":
+		return nil
+	case "bigint":
+		i, err := strconv.ParseInt(jsString(o), 10, 64)
+		if err != nil {
+			panic(err)
+		}
+		return i
+	case "number":
+		return o.Float()
+	case "string":
+		return o.String()
+	case "boolean":
+		return o.Bool()
+	}
+	if o.IsNull() {
+		return nil
+	}
+	if js.Global().Get("ArrayBuffer").Call("isView", o).Bool() {
+		b := make([]byte, o.Get("byteLength").Int())
+		js.CopyBytesToGo(b, js.Global().Get("Uint8Array").New(o.Get("buffer"), o.Get("byteOffset"), len(b)))
+		return b
+	}
+	return jsString(o)
+}
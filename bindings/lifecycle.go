@@ -0,0 +1,86 @@
+// +build js
+
+package bindings
+
+import (
+	"runtime/debug"
+	"sort"
+)
+
+// statementRegistry tracks the statements prepared on a database which have
+// not yet been freed. It holds no reference to the Statement values
+// themselves, so that abandoned statements may be garbage collected.
+type statementRegistry struct {
+	live   map[int]*LiveStatement
+	nextID int
+	report func([]LiveStatement)
+}
+
+// SetDebug enables or disables debug mode. In debug mode, the stack trace of
+// every statement prepared is recorded, and when the database is closed,
+// report is called with any statements which were never freed. Passing nil
+// disables debug mode.
+func (d *Database) SetDebug(report func(leaks []LiveStatement)) {
+	d.statements.report = report
+}
+
+// LiveStatements returns the statements prepared on the database which have
+// not been freed, in the order in which they were prepared.
+func (d *Database) LiveStatements() []LiveStatement {
+	live := make([]LiveStatement, 0, len(d.statements.live))
+	for _, s := range d.statements.live {
+		live = append(live, *s)
+	}
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].id < live[j].id
+	})
+	return live
+}
+
+// track registers a newly prepared statement. A statement which is garbage
+// collected without having been freed is freed automatically, where the
+// JavaScript runtime supports it.
+func (d *Database) track(s *Statement) {
+	r := &d.statements
+	if r.live == nil {
+		r.live = make(map[int]*LiveStatement)
+	}
+	r.nextID++
+	s.id = r.nextID
+	info := &LiveStatement{id: s.id}
+	captureError(func() {
+		info.SQL = s.SQL()
+	})
+	if r.report != nil {
+		info.Stack = string(debug.Stack())
+	}
+	r.live[s.id] = info
+
+	id, stmt := s.id, s.object()
+	setFinalizer(s, func() {
+		if _, ok := r.live[id]; ok {
+			delete(r.live, id)
+			stmt.Call("free")
+		}
+	})
+}
+
+// untrack removes a freed statement from the registry.
+func (d *Database) untrack(s *Statement) {
+	r := &d.statements
+	if _, ok := r.live[s.id]; !ok {
+		return
+	}
+	delete(r.live, s.id)
+	clearFinalizer(s)
+}
+
+// closeStatements reports leaked statements in debug mode, and clears the
+// registry, as closing the database frees all remaining statements.
+func (d *Database) closeStatements() {
+	r := &d.statements
+	if r.report != nil && len(r.live) > 0 {
+		r.report(d.LiveStatements())
+	}
+	r.live = nil
+}
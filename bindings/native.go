@@ -0,0 +1,9 @@
+// +build !js
+
+package bindings
+
+// Database is an SQL.js database. SQL.js runs only in GopherJS and
+// WebAssembly builds, so elsewhere no Database can be opened; the type is
+// declared so that code referring to it, such as the driver's ConnectHook,
+// builds everywhere.
+type Database struct{}
@@ -1,29 +1,38 @@
 // +build js
 
-// Package bindings provides minimal GopherJS bindings around the SQL.js (https://github.com/lovasoa/sql.js)
 package bindings
 
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
+	"unicode"
 
-	"github.com/gopherjs/gopherjs/js"
+	"github.com/flimzy/go-sql.js/script"
 )
 
-type Database struct {
-	*js.Object
-}
-
-type Statement struct {
-	*js.Object
+// sqlJS returns the global SQL object of SQL.js. Under node.js, it is loaded
+// with require() if it has not been loaded already.
+func sqlJS() jsObject {
+	sql := global().Get("SQL")
+	if isNil(sql) {
+		require := global().Get("require")
+		if isNil(require) {
+			panic("Cannot find global SQL object. Did you load sql.js?")
+		}
+		sql = require.Invoke("sql.js")
+		global().Set("SQL", sql)
+	}
+	return sql
 }
 
 // New returns a new database by creating a new one in memory
 //
 // See http://lovasoa.github.io/sql.js/documentation/class/Database.html#constructor-dynamic
 func New() *Database {
-	return &Database{js.Global.Get("SQL").Get("Database").New()}
+	return newDatabase(sqlJS().Get("Database").New())
 }
 
 // OpenReader opens an existing database, referenced by the passed io.Reader
@@ -32,30 +41,95 @@ func New() *Database {
 func OpenReader(r io.Reader) *Database {
 	buf := new(bytes.Buffer)
 	buf.ReadFrom(r)
-	db := js.Global.Get("SQL").Get("Database").New([]uint8(buf.Bytes()))
-	return &Database{db}
+	return newDatabase(sqlJS().Get("Database").New(uint8Array(buf.Bytes())))
 }
 
-func captureError(fn func()) (e error) {
-	defer func() {
-		if r := recover(); r != nil {
-			switch r.(type) {
-			case *js.Error:
-				e = r.(*js.Error)
-			case error:
-				e = r.(error)
-			}
-		}
-	}()
-	fn()
-	return nil
+var sqlite3Funcs = make(map[string]jsObject)
+
+// sqlite3 returns a wrapper around the named function of the SQLite C API, as
+// compiled into SQL.js. Only functions exported by the SQL.js build are
+// available; for any other function an error is returned.
+func sqlite3(name, returnType string, argTypes ...string) (jsObject, error) {
+	if fn, ok := sqlite3Funcs[name]; ok {
+		return fn, nil
+	}
+	sql := sqlJS()
+	if isNil(sql.Get("_" + name)) {
+		return undefined, fmt.Errorf("%s is not available in this build of SQL.js", name)
+	}
+	types := make([]interface{}, len(argTypes))
+	for i, t := range argTypes {
+		types[i] = t
+	}
+	fn := sql.Call("cwrap", name, returnType, types)
+	sqlite3Funcs[name] = fn
+	return fn, nil
+}
+
+// available reports whether the named SQLite C API function is exported by the
+// SQL.js build.
+func available(name string) bool {
+	if _, ok := sqlite3Funcs[name]; ok {
+		return true
+	}
+	return !isNil(sqlJS().Get("_" + name))
+}
+
+// call invokes the named SQLite C API function with the database handle as its
+// first argument.
+func (d *Database) call(name, returnType string, args ...interface{}) (r jsObject, e error) {
+	db := d.object().Get("db")
+	if isNil(db) {
+		return undefined, errors.New("database handle not available")
+	}
+	return callHandle(db.Int(), name, returnType, args)
+}
+
+// callHandle invokes the named SQLite C API function, passing handle as the
+// first argument.
+func callHandle(handle int, name, returnType string, args []interface{}) (r jsObject, e error) {
+	argTypes := make([]string, len(args)+1)
+	for i := range argTypes {
+		argTypes[i] = "number"
+	}
+	fn, err := sqlite3(name, returnType, argTypes...)
+	if err != nil {
+		return undefined, err
+	}
+	err = captureError(func() {
+		r = fn.Invoke(append([]interface{}{handle}, args...)...)
+	})
+	return r, err
+}
+
+// SetIntegerMode sets how INTEGER values are returned by the database, and by
+// statements subsequently prepared on it. The default is Float64Integers.
+//
+// In Int64Integers mode, SQL.js is asked to return INTEGER values as BigInts
+// where it supports doing so. With older versions of SQL.js, statements fall
+// back to reading the textual representation of INTEGER columns, while Exec()
+// continues to return float64 values.
+func (d *Database) SetIntegerMode(mode IntegerMode) {
+	d.integerMode = mode
+}
+
+// IntegerMode returns the current integer mode of the database.
+func (d *Database) IntegerMode() IntegerMode {
+	return d.integerMode
+}
+
+func (d *Database) config() interface{} {
+	return integerConfig(d.integerMode == Int64Integers)
 }
 
 // Run will execute one or more SQL queries (separated by ';'), ignoring the rows it returns
 //
 // See http://kripken.github.io/sql.js/documentation/class/Database.html#run-dynamic
 func (d *Database) Run(query string) (e error) {
-	return captureError(func() {
+	if d.journal != nil {
+		return d.runJournaled(query)
+	}
+	return d.captureError(query, func() {
 		d.Call("run", query)
 	})
 }
@@ -64,8 +138,16 @@ func (d *Database) Run(query string) (e error) {
 //
 // See http://kripken.github.io/sql.js/documentation/class/Database.html#run-dynamic
 func (d *Database) RunParams(query string, params []interface{}) (e error) {
-	return captureError(func() {
-		d.Call("run", query, params)
+	if d.journal != nil {
+		s, err := d.Prepare(query)
+		if err != nil {
+			return err
+		}
+		defer s.Free()
+		return s.RunParams(params)
+	}
+	return d.captureError(query, func() {
+		d.Call("run", query, jsParams(params))
 	})
 }
 
@@ -73,25 +155,32 @@ func (d *Database) RunParams(query string, params []interface{}) (e error) {
 //
 // See http://kripken.github.io/sql.js/documentation/class/Database.html#export-dynamic
 func (d *Database) Export() io.Reader {
-	array := d.Call("export").Interface()
-	return bytes.NewReader([]byte(array.([]uint8)))
+	return bytes.NewReader(goValue(d.Call("export")).([]byte))
 }
 
-// Close the database and all associated prepared statements.
+// Close the database and all associated prepared statements. In debug mode,
+// statements which were never freed are reported first; see SetDebug().
 //
 // See http://kripken.github.io/sql.js/documentation/class/Database.html#close-dynamic
 func (d *Database) Close() (e error) {
-	return captureError(func() {
+	d.closeStatements()
+	return d.captureError("", func() {
 		d.Call("close")
 	})
 }
 
 func (d *Database) prepare(query string, params interface{}) (*Statement, error) {
-	var s *js.Object
-	err := captureError(func() {
-		s = d.Call("prepare", query, params)
+	var s jsObject
+	err := d.captureError(query, func() {
+		s = d.Call("prepare", query, jsParams(params))
 	})
-	return &Statement{s}, err
+	stmt := newStatement(s)
+	stmt.db, stmt.int64 = d, d.integerMode == Int64Integers
+	stmt.params = params
+	if err == nil {
+		d.track(stmt)
+	}
+	return stmt, err
 }
 
 // Prepare an SQL statement
@@ -122,12 +211,7 @@ func (d *Database) PrepareNamedParams(query string, params map[string]interface{
 //
 // See http://kripken.github.io/sql.js/documentation/class/Database.html#getRowsModified-dynamic
 func (d *Database) GetRowsModified() int64 {
-	return d.Call("getRowsModified").Int64()
-}
-
-type Result struct {
-	Columns []string
-	Values  [][]interface{}
+	return int64(d.Call("getRowsModified").Float())
 }
 
 // Exec will execute an SQL query, and return the result.
@@ -141,9 +225,9 @@ type Result struct {
 //
 // See http://kripken.github.io/sql.js/documentation/class/Database.html#exec-dynamic
 func (d *Database) Exec(query string) (r []Result, e error) {
-	var result *js.Object
-	e = captureError(func() {
-		result = d.Call("exec", query)
+	var result jsObject
+	e = d.captureError(query, func() {
+		result = d.Call("exec", query, nil, d.config())
 	})
 	if e != nil {
 		return
@@ -161,30 +245,286 @@ func (d *Database) Exec(query string) (r []Result, e error) {
 			vals := rows.Index(j)
 			r[i].Values[j] = make([]interface{}, vals.Length())
 			for k := 0; k < vals.Length(); k++ {
-				r[i].Values[j][k] = vals.Index(k).Interface()
+				r[i].Values[j][k] = goValue(vals.Index(k))
 			}
 		}
 	}
 	return r, nil
 }
 
+// IterateStatements returns an iterator over the statements contained in
+// the passed SQL script. Each statement is prepared only when the iterator
+// reaches it, so a syntax error late in the script does not prevent the
+// statements before it from being executed. An iterator which is not run to
+// the end must be closed with Close().
+//
+// See https://sql.js.org/documentation/Database.html#["iterateStatements"]
+func (d *Database) IterateStatements(sql string) (i *StatementIterator, e error) {
+	var it jsObject
+	err := d.captureError(sql, func() {
+		it = d.Call("iterateStatements", sql)
+	})
+	if err != nil {
+		return nil, err
+	}
+	iter := newIterator(it)
+	iter.sql, iter.db = sql, d
+	return iter, nil
+}
+
+// Next prepares the next statement in the script, which can then be retrieved
+// with Statement(). It returns false when the script is exhausted, or when a
+// statement fails to prepare, in which case Err() returns the error.
+//
+// The statement returned by the previous call to Next is freed.
+func (i *StatementIterator) Next() bool {
+	if i.err != nil || i.done {
+		return false
+	}
+	if i.stmt != nil {
+		// SQL.js frees the previous statement when advancing
+		i.db.untrack(i.stmt)
+		i.stmt = nil
+	}
+	before := i.Remaining()
+	i.offset = len(i.sql) - len(before) + leadingSpace(before)
+	var next jsObject
+	if i.err = i.db.captureError(before, func() {
+		next = i.Call("next")
+	}); i.err != nil {
+		return false
+	}
+	if next.Get("done").Bool() {
+		i.done = true
+		return false
+	}
+	i.stmt = newStatement(next.Get("value"))
+	i.stmt.db, i.stmt.int64 = i.db, i.db.integerMode == Int64Integers
+	i.db.track(i.stmt)
+	text := i.stmt.SQL()
+	end := len(i.sql) - len(i.Remaining())
+	i.stmt.offset = end - len(text) + leadingSpace(text)
+	i.offset = i.stmt.offset
+	return true
+}
+
+// Close frees the current statement, if any, and the memory SQL.js holds for
+// the rest of the script. A caller which stops before Next() returns false
+// must call Close; calling it after the script is exhausted does no harm.
+//
+// See https://sql.js.org/documentation/StatementIterator.html#["finalize"]
+func (i *StatementIterator) Close() error {
+	if i.stmt != nil {
+		i.db.untrack(i.stmt)
+		i.stmt = nil
+	}
+	i.done = true
+	return i.db.captureError(i.sql, func() {
+		i.Call("finalize")
+	})
+}
+
+// Statement returns the statement most recently prepared by Next(). It is
+// valid only until the next call to Next().
+func (i *StatementIterator) Statement() *Statement {
+	return i.stmt
+}
+
+// Err returns the error, if any, encountered while preparing a statement.
+func (i *StatementIterator) Err() error {
+	return i.err
+}
+
+// Offset returns the byte offset, within the script, of the current
+// statement. If Next() failed, it is the offset of the statement which could
+// not be prepared.
+func (i *StatementIterator) Offset() int {
+	return i.offset
+}
+
+// Line returns the 1-based line number, within the script, of the current
+// statement. As with Offset(), if Next() failed, it is the line of the
+// statement which could not be prepared.
+func (i *StatementIterator) Line() int {
+	return 1 + strings.Count(i.sql[:i.offset], "\n")
+}
+
+// Remaining returns the part of the script which has not yet been prepared.
+//
+// See https://sql.js.org/documentation/StatementIterator.html#["getRemainingSQL"]
+func (i *StatementIterator) Remaining() string {
+	if i.done {
+		return ""
+	}
+	return i.Call("getRemainingSQL").String()
+}
+
+func leadingSpace(s string) int {
+	return len(s) - len(strings.TrimLeftFunc(s, unicode.IsSpace))
+}
+
+// SQL returns the SQL text of the statement.
+//
+// See https://sql.js.org/documentation/Statement.html#["getSQL"]
+func (s *Statement) SQL() string {
+	return s.Call("getSQL").String()
+}
+
+// Offset returns the byte offset of the statement within the script it was
+// read from, for statements obtained from a StatementIterator. For statements
+// created with Prepare() it is always 0.
+func (s *Statement) Offset() int {
+	return s.offset
+}
+
+// SetIntegerMode sets how INTEGER values are returned by the statement,
+// overriding the mode of the database it was prepared on.
+func (s *Statement) SetIntegerMode(mode IntegerMode) {
+	s.int64 = mode == Int64Integers
+}
+
+// handle returns the sqlite3_stmt pointer wrapped by the statement.
+func (s *Statement) handle() (int, error) {
+	stmt := s.object().Get("stmt")
+	if isNil(stmt) {
+		return 0, errors.New("statement handle not available")
+	}
+	if stmt.Int() == 0 {
+		return 0, errors.New("statement has been freed")
+	}
+	return stmt.Int(), nil
+}
+
+// call invokes the named SQLite C API function with the statement handle as
+// its first argument.
+func (s *Statement) call(name, returnType string, args ...interface{}) (r jsObject, e error) {
+	stmt, err := s.handle()
+	if err != nil {
+		return undefined, err
+	}
+	return callHandle(stmt, name, returnType, args)
+}
+
+// ExpandedSQL returns the SQL text of the statement, with the currently bound
+// parameters substituted.
+//
+// See https://www.sqlite.org/c3ref/expanded_sql.html
+func (s *Statement) ExpandedSQL() (sql string, e error) {
+	ptr, err := s.call("sqlite3_expanded_sql", "number")
+	if err != nil {
+		return "", err
+	}
+	if ptr.Int() == 0 {
+		return "", errors.New("out of memory expanding SQL")
+	}
+	sql = sqlJS().Call("UTF8ToString", ptr).String()
+	free, err := sqlite3("sqlite3_free", "", "number")
+	if err != nil {
+		return "", err
+	}
+	free.Invoke(ptr)
+	return sql, nil
+}
+
+// IsReadOnly returns true if the statement makes no direct changes to the
+// content of the database.
+//
+// Stock builds of SQL.js do not export sqlite3_stmt_readonly. With those, the
+// statement's leading keyword is checked instead: SELECT, VALUES, EXPLAIN and
+// transaction control statements are read-only, and all others, including
+// PRAGMA, are not.
+//
+// See https://www.sqlite.org/c3ref/stmt_readonly.html
+func (s *Statement) IsReadOnly() (ro bool, e error) {
+	if !available("sqlite3_stmt_readonly") {
+		return readOnlyKeyword(s.SQL()), nil
+	}
+	r, err := s.call("sqlite3_stmt_readonly", "number")
+	if err != nil {
+		return false, err
+	}
+	return r.Int() != 0, nil
+}
+
+// readOnlyKeyword reports whether a statement beginning with the keyword of
+// sql is read-only.
+func readOnlyKeyword(sql string) bool {
+	switch script.Keyword(sql) {
+	case "SELECT", "VALUES", "EXPLAIN", "BEGIN", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE":
+		return true
+	}
+	return false
+}
+
+// IsExplain returns true if the statement is an EXPLAIN or EXPLAIN QUERY PLAN
+// statement.
+//
+// See https://www.sqlite.org/c3ref/stmt_isexplain.html
+func (s *Statement) IsExplain() (explain bool, e error) {
+	r, err := s.call("sqlite3_stmt_isexplain", "number")
+	if err != nil {
+		return false, err
+	}
+	return r.Int() != 0, nil
+}
+
+// ParameterNames returns the names of the statement's parameters, in the order
+// of their indexes. Nameless parameters (i.e. "?") are returned as empty strings.
+//
+// See https://www.sqlite.org/c3ref/bind_parameter_name.html
+func (s *Statement) ParameterNames() (names []string, e error) {
+	count, err := s.call("sqlite3_bind_parameter_count", "number")
+	if err != nil {
+		return nil, err
+	}
+	names = make([]string, count.Int())
+	for i := range names {
+		name, err := s.call("sqlite3_bind_parameter_name", "string", i+1)
+		if err != nil {
+			return nil, err
+		}
+		if !isNil(name) {
+			names[i] = name.String()
+		}
+	}
+	return names, nil
+}
+
+// ColumnCount returns the number of columns in the result set returned by the
+// statement.
+//
+// See https://www.sqlite.org/c3ref/column_count.html
+func (s *Statement) ColumnCount() (n int, e error) {
+	r, err := s.call("sqlite3_column_count", "number")
+	if err != nil {
+		return 0, err
+	}
+	return r.Int(), nil
+}
+
 // Step executes the statement if necessary, and fetches the next line of the result which
 // can be retrieved with Get().
 //
 // See http://kripken.github.io/sql.js/documentation/class/Statement.html#step-dynamic
 func (s *Statement) Step() (ok bool, e error) {
-	err := captureError(func() {
+	err := s.captureError(func() {
 		ok = s.Call("step").Bool()
 	})
-	return ok, err
+	if err != nil {
+		return ok, err
+	}
+	return ok, s.journalStep()
 }
 
 func (s *Statement) get(params interface{}) (r []interface{}, e error) {
-	err := captureError(func() {
-		results := s.Call("get", params)
+	if params != nil {
+		defer s.boundAndStepped(params, &e)
+	}
+	err := s.captureError(func() {
+		results := s.Call("get", jsParams(params), s.config())
 		r = make([]interface{}, results.Length())
 		for i := 0; i < results.Length(); i++ {
-			r[i] = results.Index(i).Interface()
+			r[i] = s.columnValue(i, results.Index(i))
 		}
 	})
 	return r, err
@@ -223,10 +563,59 @@ func (s *Statement) GetColumnNames() (c []string, e error) {
 	return c, nil
 }
 
+// columnStrings calls the named SQLite C API function for each result column,
+// returning NULL results as empty strings.
+func (s *Statement) columnStrings(name string) (c []string, e error) {
+	n, err := s.ColumnCount()
+	if err != nil {
+		return nil, err
+	}
+	c = make([]string, n)
+	for i := range c {
+		r, err := s.call(name, "string", i)
+		if err != nil {
+			return nil, err
+		}
+		if !isNil(r) {
+			c[i] = r.String()
+		}
+	}
+	return c, nil
+}
+
+// ColumnDeclTypes returns the declared types of the result columns, as given
+// in the CREATE TABLE statement. Columns which are expressions or subqueries
+// have no declared type, and are returned as empty strings.
+//
+// See https://www.sqlite.org/c3ref/column_decltype.html
+func (s *Statement) ColumnDeclTypes() (c []string, e error) {
+	return s.columnStrings("sqlite3_column_decltype")
+}
+
+// ColumnTableNames returns the names of the tables from which the result
+// columns originate, or empty strings for columns which are not taken
+// directly from a table. SQL.js must be built with
+// SQLITE_ENABLE_COLUMN_METADATA.
+//
+// See https://www.sqlite.org/c3ref/column_database_name.html
+func (s *Statement) ColumnTableNames() (c []string, e error) {
+	return s.columnStrings("sqlite3_column_table_name")
+}
+
+// ColumnOriginNames returns the names of the table columns from which the
+// result columns originate, or empty strings for columns which are not taken
+// directly from a table. SQL.js must be built with
+// SQLITE_ENABLE_COLUMN_METADATA.
+//
+// See https://www.sqlite.org/c3ref/column_database_name.html
+func (s *Statement) ColumnOriginNames() (c []string, e error) {
+	return s.columnStrings("sqlite3_column_origin_name")
+}
+
 func (s *Statement) bind(params interface{}) (e error) {
 	var tf bool
-	err := captureError(func() {
-		tf = s.Call("bind", params).Bool()
+	err := s.captureError(func() {
+		tf = s.Call("bind", jsParams(params)).Bool()
 	})
 	if err != nil {
 		return err
@@ -234,6 +623,7 @@ func (s *Statement) bind(params interface{}) (e error) {
 	if !tf {
 		return errors.New("Unknown error binding parameters")
 	}
+	s.params, s.stepped = params, false
 	return nil
 }
 
@@ -257,6 +647,7 @@ func (s *Statement) BindNamed(params map[string]interface{}) (e error) {
 // See http://kripken.github.io/sql.js/documentation/class/Statement.html#reset-dynamic
 func (s *Statement) Reset() {
 	s.Call("reset")
+	s.params, s.stepped = nil, false
 }
 
 // Freemem frees memory allocated during paramater binding.
@@ -270,15 +661,23 @@ func (s *Statement) Freemem() {
 //
 // See http://kripken.github.io/sql.js/documentation/class/Statement.html#free-dynamic
 func (s *Statement) Free() bool {
+	if s.db != nil {
+		s.db.untrack(s)
+	}
 	return s.Call("free").Bool()
 }
 
 func (s *Statement) getAsMap(params interface{}) (m map[string]interface{}, e error) {
-	err := captureError(func() {
-		o := s.Call("getAsObject", params)
-		m = make(map[string]interface{}, o.Length())
-		for _, key := range js.Keys(o) {
-			m[key] = o.Get(key).Interface()
+	if params != nil {
+		defer s.boundAndStepped(params, &e)
+	}
+	err := s.captureError(func() {
+		o := s.Call("getAsObject", jsParams(params), s.config())
+		cols := s.Call("getColumnNames")
+		m = make(map[string]interface{}, cols.Length())
+		for i := 0; i < cols.Length(); i++ {
+			key := cols.Index(i).String()
+			m[key] = s.columnValue(i, o.Get(key))
 		}
 	})
 	return m, err
@@ -311,9 +710,20 @@ func (s *Statement) GetAsMapNamedParams(params map[string]interface{}) (m map[st
 }
 
 func (s *Statement) run(params interface{}) (e error) {
-	return captureError(func() {
-		s.Call("run", params)
-	})
+	if params != nil {
+		s.params = params
+	}
+	// SQL.js resets the statement after running it, which clears its
+	// bindings.
+	defer func() {
+		s.params, s.stepped = nil, false
+	}()
+	if e = s.captureError(func() {
+		s.Call("run", jsParams(params))
+	}); e != nil || s.stepped {
+		return e
+	}
+	return s.journalStep()
 }
 
 // Run is shorthand for Bind() + Step() + Reset(). Bind the values, execute the
@@ -1,3 +1,5 @@
+// +build js
+
 package bindings
 
 import (
@@ -6,6 +8,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -178,3 +181,564 @@ func TestReader2(t *testing.T) {
 	}
 
 }
+
+func TestIterateStatements(t *testing.T) {
+	db := New()
+
+	script := "CREATE TABLE foo (x int UNIQUE);\n  INSERT INTO foo (x) VALUES (1);\nINSERT INTO foo (x) VALUES (1);"
+	it, err := db.IterateStatements(script)
+	if err != nil {
+		t.Fatalf("Error iterating statements: %s", err)
+	}
+	expected := []struct {
+		offset int
+		err    bool
+	}{
+		{0, false},
+		{35, false},
+		{67, true},
+	}
+	var i int
+	for ; it.Next(); i++ {
+		stmt := it.Statement()
+		if stmt.Offset() != expected[i].offset {
+			t.Fatalf("Statement %d: unexpected offset %d, expected %d", i, stmt.Offset(), expected[i].offset)
+		}
+		if err := stmt.Run(); (err != nil) != expected[i].err {
+			t.Fatalf("Statement %d (%s): unexpected error state: %v", i, stmt.SQL(), err)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Unexpected iterator error: %s", err)
+	}
+	if i != len(expected) {
+		t.Fatalf("Iterated over %d statements, expected %d", i, len(expected))
+	}
+
+	it, err = db.IterateStatements("SELECT 1;\n\nSELECT an invalid statement")
+	if err != nil {
+		t.Fatalf("Error iterating statements: %s", err)
+	}
+	for it.Next() {
+	}
+	if it.Err() == nil {
+		t.Fatal("Expected an error preparing the second statement")
+	}
+	if err := it.Close(); err != nil {
+		t.Fatalf("Error closing iterator after a failure: %s", err)
+	}
+	if it.Offset() != 11 {
+		t.Fatalf("Unexpected offset of failed statement: %d", it.Offset())
+	}
+	if it.Line() != 3 {
+		t.Fatalf("Unexpected line of failed statement: %d", it.Line())
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing DB: %s", err)
+	}
+}
+
+func TestStatementIntrospection(t *testing.T) {
+	db := New()
+	if err := db.Run("CREATE TABLE foo (x int, y text)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+
+	stmt, err := db.Prepare("SELECT x, y FROM foo WHERE x = ? AND y = $y")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	if sql := stmt.SQL(); sql != "SELECT x, y FROM foo WHERE x = ? AND y = $y" {
+		t.Fatalf("Unexpected SQL: %s", sql)
+	}
+	if ro, err := stmt.IsReadOnly(); err != nil || !ro {
+		t.Fatalf("Expected a read-only statement: %t, %v", ro, err)
+	}
+	if explain, err := stmt.IsExplain(); err != nil || explain {
+		t.Fatalf("Expected a non-EXPLAIN statement: %t, %v", explain, err)
+	}
+	if n, err := stmt.ColumnCount(); err != nil || n != 2 {
+		t.Fatalf("Unexpected column count: %d, %v", n, err)
+	}
+	names, err := stmt.ParameterNames()
+	if err != nil {
+		t.Fatalf("Error fetching parameter names: %s", err)
+	}
+	if !reflect.DeepEqual(names, []string{"", "$y"}) {
+		t.Fatalf("Unexpected parameter names: %q", names)
+	}
+	if err := stmt.Bind([]interface{}{1, "it's"}); err != nil {
+		t.Fatalf("Error binding: %s", err)
+	}
+	expanded, err := stmt.ExpandedSQL()
+	if err != nil {
+		t.Fatalf("Error expanding SQL: %s", err)
+	}
+	if expanded != "SELECT x, y FROM foo WHERE x = 1 AND y = 'it''s'" {
+		t.Fatalf("Unexpected expanded SQL: %s", expanded)
+	}
+	stmt.Free()
+
+	stmt, err = db.Prepare("INSERT INTO foo (x) VALUES (1)")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	if ro, err := stmt.IsReadOnly(); err != nil || ro {
+		t.Fatalf("Expected a writing statement: %t, %v", ro, err)
+	}
+	stmt.Free()
+
+	stmt, err = db.Prepare("EXPLAIN QUERY PLAN SELECT * FROM foo")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	if explain, err := stmt.IsExplain(); err != nil || !explain {
+		t.Fatalf("Expected an EXPLAIN statement: %t, %v", explain, err)
+	}
+	stmt.Free()
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing DB: %s", err)
+	}
+}
+
+func TestColumnMetadata(t *testing.T) {
+	db := New()
+	if err := db.Run("CREATE TABLE foo (id INTEGER PRIMARY KEY, created DATETIME, flag BOOLEAN)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+
+	stmt, err := db.Prepare("SELECT id, created AS c, flag, 1 + 1 FROM foo")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	types, err := stmt.ColumnDeclTypes()
+	if err != nil {
+		t.Fatalf("Error fetching declared types: %s", err)
+	}
+	if expected := []string{"INTEGER", "DATETIME", "BOOLEAN", ""}; !reflect.DeepEqual(types, expected) {
+		t.Fatalf("Unexpected declared types: %q", types)
+	}
+	tables, err := stmt.ColumnTableNames()
+	if err != nil {
+		t.Fatalf("Error fetching table names: %s", err)
+	}
+	if expected := []string{"foo", "foo", "foo", ""}; !reflect.DeepEqual(tables, expected) {
+		t.Fatalf("Unexpected table names: %q", tables)
+	}
+	origins, err := stmt.ColumnOriginNames()
+	if err != nil {
+		t.Fatalf("Error fetching origin names: %s", err)
+	}
+	if expected := []string{"id", "created", "flag", ""}; !reflect.DeepEqual(origins, expected) {
+		t.Fatalf("Unexpected origin names: %q", origins)
+	}
+	stmt.Free()
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing DB: %s", err)
+	}
+}
+
+func TestBlobRoundTrip(t *testing.T) {
+	db := New()
+	if err := db.Run("CREATE TABLE foo (b BLOB)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	blob := []byte{0, 1, 0, 255, 0}
+	if err := db.RunParams("INSERT INTO foo (b) VALUES (?)", []interface{}{blob}); err != nil {
+		t.Fatalf("Error inserting blob: %s", err)
+	}
+
+	stmt, err := db.Prepare("SELECT b, typeof(b) FROM foo")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	stmt.Step()
+	row, err := stmt.Get()
+	if err != nil {
+		t.Fatalf("Error calling Get(): %s", err)
+	}
+	if b, ok := row[0].([]byte); !ok || !bytes.Equal(b, blob) {
+		t.Fatalf("Unexpected blob from Get(): %#v", row[0])
+	}
+	if typ := row[1].(string); typ != "blob" {
+		t.Fatalf("Value stored as %s instead of blob", typ)
+	}
+	m, err := stmt.GetAsMap()
+	if err != nil {
+		t.Fatalf("Error calling GetAsMap(): %s", err)
+	}
+	if b, ok := m["b"].([]byte); !ok || !bytes.Equal(b, blob) {
+		t.Fatalf("Unexpected blob from GetAsMap(): %#v", m["b"])
+	}
+	stmt.Free()
+
+	result, err := db.Exec("SELECT b FROM foo")
+	if err != nil {
+		t.Fatalf("Error with Exec(): %s", err)
+	}
+	if b, ok := result[0].Values[0][0].([]byte); !ok || !bytes.Equal(b, blob) {
+		t.Fatalf("Unexpected blob from Exec(): %#v", result[0].Values[0][0])
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing DB: %s", err)
+	}
+}
+
+func TestInt64(t *testing.T) {
+	db := New()
+	db.SetIntegerMode(Int64Integers)
+	if err := db.Run("CREATE TABLE foo (id INTEGER PRIMARY KEY, f REAL)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	const big = int64(1<<62 + 1)
+	if err := db.RunParams("INSERT INTO foo (id, f) VALUES (?, ?)", []interface{}{big, 1.0}); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	if err := db.RunParams("INSERT INTO foo (id, f) VALUES (?, ?)", []interface{}{int64(-42), 2.5}); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+
+	stmt, err := db.Prepare("SELECT id, f FROM foo ORDER BY f")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	for _, expected := range [][]interface{}{{big, 1.0}, {int64(-42), 2.5}} {
+		if ok, err := stmt.Step(); err != nil || !ok {
+			t.Fatalf("Error stepping: %t, %v", ok, err)
+		}
+		row, err := stmt.Get()
+		if err != nil {
+			t.Fatalf("Error calling Get(): %s", err)
+		}
+		if !reflect.DeepEqual(row, expected) {
+			t.Fatalf("Unexpected row: %#v, expected %#v", row, expected)
+		}
+	}
+	stmt.Free()
+
+	stmt, err = db.Prepare("SELECT id FROM foo WHERE id = ?")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	m, err := stmt.GetAsMapParams([]interface{}{big})
+	if err != nil {
+		t.Fatalf("Error calling GetAsMapParams(): %s", err)
+	}
+	if id, ok := m["id"].(int64); !ok || id != big {
+		t.Fatalf("Unexpected id: %#v", m["id"])
+	}
+	stmt.Free()
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing DB: %s", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	db := New()
+	err := db.Run("CREATE TABLE foo (x int); SELECT * FROM bar")
+	sqlErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Unexpected error type: %#v", err)
+	}
+	if sqlErr.Code != ErrError.Code || sqlErr.Message != "no such table: bar" {
+		t.Fatalf("Unexpected error: %d, %s", sqlErr.Code, sqlErr.Message)
+	}
+
+	_, err = db.Prepare("SELECT * FROM foo WHERE")
+	sqlErr, ok = err.(*Error)
+	if !ok {
+		t.Fatalf("Unexpected error type: %#v", err)
+	}
+	if sqlErr.SQL != "SELECT * FROM foo WHERE" {
+		t.Fatalf("Unexpected SQL: %s", sqlErr.SQL)
+	}
+
+	if err := captureError(func() { panic("not an error") }); err == nil || err.Error() != "not an error" {
+		t.Fatalf("Unexpected result of non-error panic: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing DB: %s", err)
+	}
+}
+
+func TestStatementLifecycle(t *testing.T) {
+	db := New()
+	var leaks []LiveStatement
+	db.SetDebug(func(l []LiveStatement) {
+		leaks = l
+	})
+
+	freed, err := db.Prepare("SELECT 1")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	if _, err := db.Prepare("SELECT 2"); err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	if live := db.LiveStatements(); len(live) != 2 {
+		t.Fatalf("Expected 2 live statements, found %d", len(live))
+	}
+	freed.Free()
+	live := db.LiveStatements()
+	if len(live) != 1 || live[0].SQL != "SELECT 2" {
+		t.Fatalf("Unexpected live statements: %v", live)
+	}
+
+	it, err := db.IterateStatements("SELECT 3; SELECT 4")
+	if err != nil {
+		t.Fatalf("Error iterating statements: %s", err)
+	}
+	for it.Next() {
+		if n := len(db.LiveStatements()); n != 2 {
+			t.Fatalf("Expected 2 live statements while iterating, found %d", n)
+		}
+	}
+	if n := len(db.LiveStatements()); n != 1 {
+		t.Fatalf("Expected 1 live statement after iterating, found %d", n)
+	}
+
+	// An iterator closed early frees its current statement.
+	it, err = db.IterateStatements("SELECT 5; SELECT 6")
+	if err != nil {
+		t.Fatalf("Error iterating statements: %s", err)
+	}
+	if !it.Next() {
+		t.Fatalf("Error preparing statement: %v", it.Err())
+	}
+	if err := it.Close(); err != nil {
+		t.Fatalf("Error closing iterator: %s", err)
+	}
+	if n := len(db.LiveStatements()); n != 1 {
+		t.Fatalf("Expected 1 live statement after closing the iterator, found %d", n)
+	}
+	if it.Next() || it.Err() != nil || it.Remaining() != "" {
+		t.Fatalf("Expected a closed iterator to be exhausted: %v", it.Err())
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing DB: %s", err)
+	}
+	if len(leaks) != 1 || leaks[0].SQL != "SELECT 2" {
+		t.Fatalf("Unexpected leaks reported: %v", leaks)
+	}
+	if !strings.Contains(leaks[0].Stack, "TestStatementLifecycle") {
+		t.Fatalf("Creation stack not recorded: %s", leaks[0].Stack)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	db := New()
+	defer db.Close()
+	if err := db.Run(`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT, data BLOB);
+CREATE TABLE tags (name TEXT PRIMARY KEY, color TEXT) WITHOUT ROWID`); err != nil {
+		t.Fatalf("Error creating tables: %s", err)
+	}
+	m, err := db.NewUndoManager("items", "tags")
+	if err != nil {
+		t.Fatalf("Error creating undo manager: %s", err)
+	}
+	defer m.Close()
+	state := func() string {
+		res, err := db.Exec(`SELECT (SELECT group_concat(id || ':' || name || ':' || hex(data), ',') FROM items)
+			|| ' ' || (SELECT group_concat(name || ':' || color, ',') FROM tags)`)
+		if err != nil {
+			t.Fatalf("Error reading state: %s", err)
+		}
+		return fmt.Sprint(res[0].Values[0][0])
+	}
+
+	if m.CanUndo() || m.CanRedo() {
+		t.Fatalf("Expected empty history")
+	}
+	if _, err := m.Undo(); err != ErrNothingToUndo {
+		t.Fatalf("Expected ErrNothingToUndo, got %v", err)
+	}
+	steps := []struct{ name, sql string }{
+		{"add", "INSERT INTO items VALUES (1, 'one', x'00ff'); INSERT INTO tags VALUES ('red', '#f00')"},
+		{"edit", "UPDATE items SET id = 2, name = 'two', data = NULL; UPDATE tags SET color = 'red'"},
+		{"delete", "DELETE FROM items; DELETE FROM tags"},
+	}
+	var states []string
+	for _, s := range steps {
+		states = append(states, state())
+		if err := db.Run(s.sql); err != nil {
+			t.Fatalf("Error running %s: %s", s.name, err)
+		}
+		if err := m.Step(s.name); err != nil {
+			t.Fatalf("Error recording step %s: %s", s.name, err)
+		}
+	}
+	final := state()
+	if m.UndoName() != "delete" {
+		t.Errorf("Unexpected undo name: %s", m.UndoName())
+	}
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		name, err := m.Undo()
+		if err != nil || name != steps[i].name {
+			t.Fatalf("Unexpected undo result: %s, %v", name, err)
+		}
+		if got := state(); got != states[i] {
+			t.Fatalf("After undoing %s, expected %q, got %q", name, states[i], got)
+		}
+	}
+	if m.CanUndo() || !m.CanRedo() || m.RedoName() != "add" {
+		t.Fatalf("Unexpected history after undoing all steps")
+	}
+	for i := range steps {
+		if name, err := m.Redo(); err != nil || name != steps[i].name {
+			t.Fatalf("Unexpected redo result: %s, %v", name, err)
+		}
+	}
+	if got := state(); got != final {
+		t.Fatalf("After redoing, expected %q, got %q", final, got)
+	}
+
+	// New changes discard the redo history.
+	if _, err := m.Undo(); err != nil {
+		t.Fatalf("Error undoing: %s", err)
+	}
+	if err := db.Run("INSERT INTO items VALUES (3, 'three', NULL)"); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	if m.CanRedo() {
+		t.Fatalf("Expected redo history to be discarded")
+	}
+	if name, err := m.Undo(); err != nil || name != "" {
+		t.Fatalf("Unexpected undo result: %s, %v", name, err)
+	}
+	if got := state(); got != states[2] {
+		t.Fatalf("Expected %q, got %q", states[2], got)
+	}
+
+	if err := m.SetLimit(1); err != nil {
+		t.Fatalf("Error setting limit: %s", err)
+	}
+	if _, err := m.Undo(); err != nil {
+		t.Fatalf("Error undoing: %s", err)
+	}
+	if _, err := m.Undo(); err != ErrNothingToUndo {
+		t.Fatalf("Expected history to be limited, got %v", err)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	db := New()
+	defer db.Close()
+	journal := new(bytes.Buffer)
+	db.SetJournal(journal)
+
+	if err := db.Run("CREATE TABLE t (x, y); SELECT 1"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	if err := db.Run("SELECT * FROM t"); err != nil {
+		t.Fatalf("Error querying: %s", err)
+	}
+	if err := db.RunParams("INSERT INTO t VALUES (?, ?)", []interface{}{int64(9007199254740993), []byte{0, 255}}); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	s, err := db.Prepare("INSERT INTO t VALUES (:x, :y)")
+	if err != nil {
+		t.Fatalf("Error preparing: %s", err)
+	}
+	if err := s.RunNamedParams(map[string]interface{}{":x": 1.5, ":y": "it's"}); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	s.Free()
+	if err := db.Run("BEGIN; DELETE FROM t; ROLLBACK"); err != nil {
+		t.Fatalf("Error running transaction: %s", err)
+	}
+	if err := db.Run("INSERT INTO t VALUES (2, 3); INSERT INTO missing VALUES (1)"); err == nil {
+		t.Fatalf("Expected an error inserting into a missing table")
+	}
+
+	expected := `{"q":"CREATE TABLE t (x, y);"}
+{"q":"INSERT INTO t VALUES (?, ?)","p":[9007199254740993,{"b":"AP8="}]}
+{"q":"INSERT INTO t VALUES (:x, :y)","n":{":x":1.5,":y":"it's"}}
+{"q":"BEGIN;"}
+{"q":"DELETE FROM t;"}
+{"q":"ROLLBACK"}
+{"q":"INSERT INTO t VALUES (2, 3);"}
+`
+	if journal.String() != expected {
+		t.Fatalf("Unexpected journal:\n%s", journal)
+	}
+
+	replayed := New()
+	defer replayed.Close()
+	replayed.SetIntegerMode(Int64Integers)
+	if err := Replay(strings.NewReader(journal.String()), replayed); err != nil {
+		t.Fatalf("Error replaying journal: %s", err)
+	}
+	res, err := replayed.Exec("SELECT x, typeof(x), y FROM t ORDER BY rowid")
+	if err != nil {
+		t.Fatalf("Error querying replayed database: %s", err)
+	}
+	rows := [][]interface{}{
+		{int64(9007199254740993), "integer", []byte{0, 255}},
+		{1.5, "real", "it's"},
+		{int64(2), "integer", int64(3)},
+	}
+	if len(res) != 1 || !reflect.DeepEqual(res[0].Values, rows) {
+		t.Fatalf("Unexpected replayed rows: %v", res)
+	}
+
+	err = Replay(strings.NewReader(`{"q":"INSERT INTO missing VALUES (1)"}`), replayed)
+	if e, ok := err.(*ReplayError); !ok || e.Entry != 1 {
+		t.Fatalf("Expected replay error for entry 1, got %v", err)
+	}
+}
+
+func TestJournalCommentedCommit(t *testing.T) {
+	db := New()
+	defer db.Close()
+	journal := new(bytes.Buffer)
+	db.SetJournal(journal)
+
+	if err := db.Run("CREATE TABLE t (x); BEGIN; INSERT INTO t VALUES (1); -- done\nCOMMIT;"); err != nil {
+		t.Fatalf("Error running script: %s", err)
+	}
+	if !strings.Contains(journal.String(), `COMMIT;"}`) {
+		t.Fatalf("Expected COMMIT to be journaled:\n%s", journal)
+	}
+
+	replayed := New()
+	defer replayed.Close()
+	if err := Replay(strings.NewReader(journal.String()), replayed); err != nil {
+		t.Fatalf("Error replaying journal: %s", err)
+	}
+	// The replayed transaction must have been committed.
+	if err := replayed.Run("BEGIN; INSERT INTO t VALUES (2); COMMIT"); err != nil {
+		t.Fatalf("Error running a transaction after replay: %s", err)
+	}
+	res, err := replayed.Exec("SELECT count(*) FROM t")
+	if err != nil {
+		t.Fatalf("Error querying replayed database: %s", err)
+	}
+	if len(res) != 1 || !reflect.DeepEqual(res[0].Values, [][]interface{}{{float64(2)}}) {
+		t.Fatalf("Unexpected replayed rows: %v", res)
+	}
+}
+
+func TestReadOnlyKeyword(t *testing.T) {
+	tests := map[string]bool{
+		"SELECT 1":                             true,
+		"/* comment */ values (1)":             true,
+		"WITH x AS (SELECT 1) SELECT * FROM x": true,
+		"WITH x AS (SELECT 1) DELETE FROM foo": false,
+		"BEGIN":                                true,
+		"INSERT INTO foo (x) VALUES (1)":       false,
+		"PRAGMA user_version":                  false,
+	}
+	for sql, expected := range tests {
+		if result := readOnlyKeyword(sql); result != expected {
+			t.Errorf("readOnlyKeyword(%q) = %t, expected %t", sql, result, expected)
+		}
+	}
+}
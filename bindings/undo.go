@@ -0,0 +1,338 @@
+// +build js
+
+package bindings
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// ErrNothingToUndo is returned by UndoManager.Undo when the undo history is
+// empty.
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// ErrNothingToRedo is returned by UndoManager.Redo when the redo history is
+// empty.
+var ErrNothingToRedo = errors.New("nothing to redo")
+
+// UndoLogTable is the name of the temporary table in which an UndoManager
+// records inverse SQL statements.
+const UndoLogTable = "_undolog"
+
+// UndoManager records the inverse of every change made to tracked tables, so
+// that changes can be undone and redone. Changes are grouped into named
+// steps by calling Step after each logical edit.
+//
+// It is implemented with temporary triggers, following
+// https://www.sqlite.org/undoredo.html, so only one UndoManager may be
+// active on a database at a time.
+type UndoManager struct {
+	db      *Database
+	tables  []string
+	undo    []undoStep
+	redo    []undoStep
+	limit   int
+	lastSeq int64
+}
+
+// undoStep is a range of entries in the undo log.
+type undoStep struct {
+	name        string
+	first, last int64
+}
+
+// NewUndoManager creates the undo log, and installs triggers on the named
+// tables.
+func (d *Database) NewUndoManager(tables ...string) (*UndoManager, error) {
+	if err := d.Run("CREATE TEMP TABLE " + script.QuoteIdent(UndoLogTable) + " (seq INTEGER PRIMARY KEY, sql TEXT NOT NULL)"); err != nil {
+		return nil, err
+	}
+	m := &UndoManager{db: d}
+	if err := m.Track(tables...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Track installs triggers on the named tables, so that changes to them are
+// recorded.
+func (m *UndoManager) Track(tables ...string) error {
+	for _, table := range tables {
+		if err := m.track(table); err != nil {
+			return fmt.Errorf("undo: track %s: %w", table, err)
+		}
+		m.tables = append(m.tables, table)
+	}
+	return nil
+}
+
+func (m *UndoManager) track(table string) error {
+	info, err := m.db.Exec("PRAGMA table_info(" + script.QuoteIdent(table) + ")")
+	if err != nil {
+		return err
+	}
+	if len(info) == 0 {
+		return errors.New("no such table")
+	}
+	var cols, pk []string
+	for _, row := range info[0].Values {
+		name := fmt.Sprint(row[1])
+		cols = append(cols, name)
+		if fmt.Sprint(row[5]) != "0" {
+			pk = append(pk, name)
+		}
+	}
+	// Tables with rowids are keyed by rowid, which is stable even when the
+	// primary key is not an INTEGER PRIMARY KEY.
+	if _, err := m.db.Exec("SELECT rowid FROM " + script.QuoteIdent(table) + " LIMIT 0"); err == nil {
+		pk = nil
+		cols = append([]string{"rowid"}, cols...)
+	}
+	where := func(row string) string {
+		if pk == nil {
+			return script.Literal(" WHERE rowid=") + "||" + row + ".rowid"
+		}
+		terms := make([]string, len(pk))
+		for i, col := range pk {
+			terms[i] = script.Literal(script.QuoteIdent(col)+"=") + "||quote(" + row + "." + script.QuoteIdent(col) + ")"
+		}
+		return script.Literal(" WHERE ") + "||" + strings.Join(terms, "||"+script.Literal(" AND ")+"||")
+	}
+	set := make([]string, len(cols))
+	names := make([]string, len(cols))
+	values := make([]string, len(cols))
+	for i, col := range cols {
+		if col != "rowid" {
+			col = script.QuoteIdent(col)
+		}
+		set[i] = script.Literal(col+"=") + "||quote(OLD." + col + ")"
+		names[i] = col
+		values[i] = "quote(OLD." + col + ")"
+	}
+	t := script.QuoteIdent(table)
+	inverse := map[string]string{
+		"INSERT": script.Literal("DELETE FROM "+t) + "||" + where("NEW"),
+		"UPDATE": script.Literal("UPDATE "+t+" SET ") + "||" + strings.Join(set, "||','||") + "||" + where("NEW"),
+		"DELETE": script.Literal("INSERT INTO "+t+" ("+strings.Join(names, ",")+") VALUES (") + "||" +
+			strings.Join(values, "||','||") + "||')'",
+	}
+	for _, event := range []string{"INSERT", "UPDATE", "DELETE"} {
+		query := fmt.Sprintf("CREATE TEMP TRIGGER %s AFTER %s ON %s BEGIN INSERT INTO %s (sql) VALUES (%s); END",
+			script.QuoteIdent(undoTrigger(table, event)), event, t, script.QuoteIdent(UndoLogTable), inverse[event])
+		if err := m.db.Run(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func undoTrigger(table, event string) string {
+	return "_undo_" + table + "_" + strings.ToLower(event)
+}
+
+// Close removes the triggers and the undo log.
+func (m *UndoManager) Close() error {
+	for _, table := range m.tables {
+		for _, event := range []string{"INSERT", "UPDATE", "DELETE"} {
+			if err := m.db.Run("DROP TRIGGER IF EXISTS temp." + script.QuoteIdent(undoTrigger(table, event))); err != nil {
+				return err
+			}
+		}
+	}
+	m.tables = nil
+	m.undo, m.redo = nil, nil
+	return m.db.Run("DROP TABLE IF EXISTS temp." + script.QuoteIdent(UndoLogTable))
+}
+
+func (m *UndoManager) queryInt(query string) (int64, error) {
+	res, err := m.db.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	if len(res) == 0 || len(res[0].Values) == 0 {
+		return 0, nil
+	}
+	switch v := res[0].Values[0][0].(type) {
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	}
+	return 0, nil
+}
+
+func (m *UndoManager) maxSeq() (int64, error) {
+	return m.queryInt("SELECT coalesce(max(seq), 0) FROM " + script.QuoteIdent(UndoLogTable))
+}
+
+// Step groups the changes made since the previous step into an undo step
+// with the given name, which is then the step undone by Undo. It discards
+// the redo history. If there have been no changes, Step does nothing.
+func (m *UndoManager) Step(name string) error {
+	last, err := m.maxSeq()
+	if err != nil || last <= m.lastSeq {
+		return err
+	}
+	if err := m.deleteSteps(m.redo); err != nil {
+		return err
+	}
+	m.redo = nil
+	m.undo = append(m.undo, undoStep{name: name, first: m.lastSeq + 1, last: last})
+	m.lastSeq = last
+	return m.trim()
+}
+
+func (m *UndoManager) deleteSteps(steps []undoStep) error {
+	for _, s := range steps {
+		if err := m.db.Run(fmt.Sprintf("DELETE FROM %s WHERE seq BETWEEN %d AND %d", script.QuoteIdent(UndoLogTable), s.first, s.last)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trim discards the oldest undo steps beyond the history limit.
+func (m *UndoManager) trim() error {
+	if m.limit <= 0 || len(m.undo) <= m.limit {
+		return nil
+	}
+	n := len(m.undo) - m.limit
+	if err := m.deleteSteps(m.undo[:n]); err != nil {
+		return err
+	}
+	m.undo = append([]undoStep{}, m.undo[n:]...)
+	return nil
+}
+
+// SetLimit sets the maximum number of steps kept in the undo history, with
+// older steps discarded first. A limit of 0, the default, keeps all steps.
+func (m *UndoManager) SetLimit(limit int) error {
+	m.limit = limit
+	return m.trim()
+}
+
+// Limit returns the maximum number of steps kept in the undo history.
+func (m *UndoManager) Limit() int {
+	return m.limit
+}
+
+// pending reports whether changes have been made since the last step.
+func (m *UndoManager) pending() bool {
+	last, err := m.maxSeq()
+	return err == nil && last > m.lastSeq
+}
+
+// CanUndo returns true if there are changes which can be undone.
+func (m *UndoManager) CanUndo() bool {
+	return len(m.undo) > 0 || m.pending()
+}
+
+// CanRedo returns true if there are undone changes which can be redone.
+func (m *UndoManager) CanRedo() bool {
+	return len(m.redo) > 0 && !m.pending()
+}
+
+// UndoName returns the name of the step which Undo would undo. Changes made
+// since the last step have an empty name.
+func (m *UndoManager) UndoName() string {
+	if len(m.undo) == 0 || m.pending() {
+		return ""
+	}
+	return m.undo[len(m.undo)-1].name
+}
+
+// RedoName returns the name of the step which Redo would redo.
+func (m *UndoManager) RedoName() string {
+	if len(m.redo) == 0 {
+		return ""
+	}
+	return m.redo[len(m.redo)-1].name
+}
+
+// Undo reverts the most recent step, and returns its name. Changes made
+// since the last call to Step are first grouped into an unnamed step.
+func (m *UndoManager) Undo() (string, error) {
+	if err := m.Step(""); err != nil {
+		return "", err
+	}
+	if len(m.undo) == 0 {
+		return "", ErrNothingToUndo
+	}
+	step := m.undo[len(m.undo)-1]
+	inverse, err := m.replay(step)
+	if err != nil {
+		return "", err
+	}
+	m.undo = m.undo[:len(m.undo)-1]
+	m.redo = append(m.redo, inverse)
+	return step.name, nil
+}
+
+// Redo reapplies the most recently undone step, and returns its name.
+func (m *UndoManager) Redo() (string, error) {
+	if err := m.Step(""); err != nil {
+		return "", err
+	}
+	if len(m.redo) == 0 {
+		return "", ErrNothingToRedo
+	}
+	step := m.redo[len(m.redo)-1]
+	inverse, err := m.replay(step)
+	if err != nil {
+		return "", err
+	}
+	m.redo = m.redo[:len(m.redo)-1]
+	m.undo = append(m.undo, inverse)
+	return step.name, nil
+}
+
+// replay executes the statements of a step in reverse order, and returns the
+// step recorded by the triggers while doing so, which reverses it.
+func (m *UndoManager) replay(step undoStep) (s undoStep, err error) {
+	log := script.QuoteIdent(UndoLogTable)
+	res, err := m.db.Exec(fmt.Sprintf("SELECT sql FROM %s WHERE seq BETWEEN %d AND %d ORDER BY seq DESC", log, step.first, step.last))
+	if err != nil {
+		return s, err
+	}
+	if err := m.db.Run("SAVEPOINT undo"); err != nil {
+		return s, err
+	}
+	defer func() {
+		if err != nil {
+			m.db.Run("ROLLBACK TO undo")
+		}
+		m.db.Run("RELEASE undo")
+	}()
+	if err := m.deleteSteps([]undoStep{step}); err != nil {
+		return s, err
+	}
+	first, err := m.maxSeq()
+	if err != nil {
+		return s, err
+	}
+	if len(res) > 0 {
+		for _, row := range res[0].Values {
+			if err := m.db.Run(fmt.Sprint(row[0])); err != nil {
+				return s, err
+			}
+		}
+	}
+	last, err := m.maxSeq()
+	if err != nil {
+		return s, err
+	}
+	m.lastSeq = last
+	return undoStep{name: step.name, first: first + 1, last: last}, nil
+}
+
+// Clear discards the undo and redo history.
+func (m *UndoManager) Clear() error {
+	if err := m.db.Run("DELETE FROM " + script.QuoteIdent(UndoLogTable)); err != nil {
+		return err
+	}
+	m.undo, m.redo, m.lastSeq = nil, nil, 0
+	return nil
+}
@@ -0,0 +1,142 @@
+// +build js
+
+package bindings
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// jsParams converts the Go parameters passed to a Bind(), Get(), Run() or
+// Prepare() call into the values expected by SQL.js. params may be nil, a
+// []interface{} or a map[string]interface{}.
+func jsParams(params interface{}) interface{} {
+	switch p := params.(type) {
+	case []interface{}:
+		values := make([]interface{}, len(p))
+		for i, v := range p {
+			values[i] = jsValue(v)
+		}
+		return values
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(p))
+		for k, v := range p {
+			values[k] = jsValue(v)
+		}
+		return values
+	}
+	return params
+}
+
+// jsValue converts a single parameter value. Byte slices, including named
+// types such as sql.RawBytes, are converted to a Uint8Array so that SQL.js
+// binds them as BLOBs. Other named types are converted to their underlying
+// type, as syscall/js accepts only the basic types, and integers which may be
+// 64 bits wide are converted by jsInt64. Times are bound as text, by
+// timeValue.
+func jsValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return uint8Array(t)
+	case int64:
+		return jsInt64(t)
+	case int:
+		return jsInt64(int64(t))
+	case uint64:
+		if t > math.MaxInt64 {
+			return strconv.FormatUint(t, 10)
+		}
+		return jsInt64(int64(t))
+	case uint:
+		return jsValue(uint64(t))
+	case time.Time:
+		return timeValue(t)
+	case jsObject, bool, string, float64, float32, int8, int16, int32, uint8, uint16, uint32:
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return uint8Array(rv.Bytes())
+		}
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String:
+		return rv.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return jsInt64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsValue(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return v
+}
+
+// timeValue converts a time to the RFC 3339 text which is bound, and
+// journaled, in its place.
+func timeValue(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// maxSafeInteger is the largest integer which can be represented exactly by
+// a JavaScript number.
+const maxSafeInteger = 1<<53 - 1
+
+// jsInt64 converts i to a JavaScript value without loss of precision. Values
+// which cannot be represented exactly by a number are passed as BigInts, or
+// as strings when BigInt is not available.
+func jsInt64(i int64) interface{} {
+	if i >= -maxSafeInteger && i <= maxSafeInteger {
+		return float64(i)
+	}
+	str := strconv.FormatInt(i, 10)
+	if bigInt := global().Get("BigInt"); !isNil(bigInt) {
+		return bigInt.Invoke(str)
+	}
+	return str
+}
+
+// integerConfig returns the configuration object passed to SQL.js's get(),
+// getAsObject() and exec() methods.
+func integerConfig(useBigInt bool) interface{} {
+	if !useBigInt {
+		return nil
+	}
+	return map[string]interface{}{"useBigInt": true}
+}
+
+// sqliteInteger is the SQLITE_INTEGER fundamental datatype.
+const sqliteInteger = 1
+
+func (s *Statement) config() interface{} {
+	return integerConfig(s.int64)
+}
+
+// columnValue converts the value of column i of the current row to its Go
+// equivalent. In Int64Integers mode, INTEGER values which SQL.js returned as
+// numbers are re-read as text, to recover their exact value.
+func (s *Statement) columnValue(i int, o jsObject) interface{} {
+	v := goValue(o)
+	if _, ok := v.(float64); !ok || !s.int64 {
+		return v
+	}
+	typ, err := s.call("sqlite3_column_type", "number", i)
+	if err != nil || typ.Int() != sqliteInteger {
+		return v
+	}
+	text, err := s.call("sqlite3_column_text", "string", i)
+	if err != nil {
+		return v
+	}
+	n, err := strconv.ParseInt(text.String(), 10, 64)
+	if err != nil {
+		return v
+	}
+	return n
+}
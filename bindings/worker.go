@@ -0,0 +1,280 @@
+// +build js
+
+package bindings
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// WorkerDatabase is a database which lives inside a Web Worker (or a node.js
+// worker_threads Worker) running the sqljs-worker.js script from the worker
+// package, so that long queries do not block the main JavaScript thread.
+//
+// Each method sends a request to the worker with postMessage, and blocks the
+// calling goroutine, but not the JavaScript event loop, until the worker
+// replies. The methods must therefore not be called from a JavaScript
+// callback, such as an event handler, without starting a new goroutine. They
+// are safe for concurrent use; the worker executes requests in the order in
+// which they are sent.
+//
+// A method whose context is cancelled returns ctx.Err() at once, but the
+// worker cannot be interrupted, and still executes the request. A cancelled
+// BEGIN, for example, still begins a transaction.
+type WorkerDatabase struct {
+	worker  jsObject
+	release []func()
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan jsObject
+	err     error
+}
+
+// NewWorker starts a new worker running the script at url: a Web Worker in the
+// browser, or a worker_threads Worker under node.js, where url is a file path.
+//
+// In the browser, the URL of sql.js may be passed to the script as its
+// "sqljs" query parameter, such as "sqljs-worker.js?sqljs=/js/sql.js".
+func NewWorker(url string) jsObject {
+	if worker := global().Get("Worker"); !isNil(worker) {
+		return worker.New(url)
+	}
+	return global().Call("require", "worker_threads").Get("Worker").New(url)
+}
+
+// OpenWorker opens a database inside worker, which must run the
+// sqljs-worker.js script, such as a worker returned by NewWorker. If r is
+// nil, a new empty database is created in memory; otherwise the database is
+// read from r.
+func OpenWorker(ctx context.Context, worker jsObject, r io.Reader) (*WorkerDatabase, error) {
+	d := &WorkerDatabase{
+		worker:  worker,
+		pending: make(map[int]chan jsObject),
+	}
+	onMessage := func(data jsObject) {
+		d.mu.Lock()
+		id := data.Get("id").Int()
+		ch, ok := d.pending[id]
+		delete(d.pending, id)
+		d.mu.Unlock()
+		if ok {
+			ch <- data
+		}
+	}
+	onError := func(err jsObject) {
+		d.fail(errors.New(errorMessage(err)))
+	}
+	listen := func(fn func(jsObject)) jsObject {
+		f, release := newFunc(func(args []jsObject) interface{} {
+			fn(args[0])
+			return nil
+		})
+		d.release = append(d.release, release)
+		return f
+	}
+	if !isNil(worker.Get("on")) {
+		worker.Call("on", "message", listen(onMessage))
+		worker.Call("on", "error", listen(onError))
+	} else {
+		worker.Call("addEventListener", "message", listen(func(event jsObject) {
+			onMessage(event.Get("data"))
+		}))
+		worker.Call("addEventListener", "error", listen(onError))
+	}
+	msg := map[string]interface{}{"action": "open"}
+	if r != nil {
+		buf := new(bytes.Buffer)
+		if _, err := buf.ReadFrom(r); err != nil {
+			return nil, err
+		}
+		msg["buffer"] = uint8Array(buf.Bytes())
+	}
+	if _, err := d.send(ctx, "", msg); err != nil {
+		d.terminate()
+		return nil, err
+	}
+	return d, nil
+}
+
+// fail marks d as failed with err, and wakes up every pending request.
+func (d *WorkerDatabase) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err == nil {
+		d.err = err
+	}
+	for id, ch := range d.pending {
+		delete(d.pending, id)
+		close(ch)
+	}
+}
+
+// send posts msg to the worker, and waits for its reply. query is the SQL
+// text reported in any error.
+func (d *WorkerDatabase) send(ctx context.Context, query string, msg map[string]interface{}) (jsObject, error) {
+	ch := make(chan jsObject, 1)
+	d.mu.Lock()
+	if d.err != nil {
+		d.mu.Unlock()
+		return undefined, d.err
+	}
+	d.nextID++
+	id := d.nextID
+	d.pending[id] = ch
+	d.mu.Unlock()
+
+	msg["id"] = id
+	if err := captureError(func() {
+		d.worker.Call("postMessage", msg)
+	}); err != nil {
+		d.mu.Lock()
+		delete(d.pending, id)
+		d.mu.Unlock()
+		return undefined, err
+	}
+
+	select {
+	case reply, ok := <-ch:
+		if !ok {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return undefined, d.err
+		}
+		if e := reply.Get("error"); !isNil(e) {
+			return undefined, workerError(query, reply)
+		}
+		return reply, nil
+	case <-ctx.Done():
+		// The worker cannot be interrupted, so the reply is discarded
+		// when it arrives.
+		d.mu.Lock()
+		delete(d.pending, id)
+		d.mu.Unlock()
+		return undefined, ctx.Err()
+	}
+}
+
+// workerError converts an error reply from the worker into an *Error. The
+// result codes are taken from the reply when the worker could read them, and
+// otherwise inferred from the message.
+func workerError(query string, reply jsObject) *Error {
+	e := ErrorFromMessage(query, reply.Get("error").String())
+	if code := reply.Get("code"); !isNil(code) && code.Int() != 0 {
+		e.Code, e.ExtendedCode = code.Int(), code.Int()
+		if ext := reply.Get("extendedCode"); !isNil(ext) && ext.Int() != 0 {
+			e.ExtendedCode = ext.Int()
+		}
+	}
+	return e
+}
+
+// Exec executes one or more SQL statements, and returns the result of each,
+// like Database.Exec(), and the number of rows modified, inserted or deleted
+// by the last INSERT, UPDATE or DELETE statement. INTEGER values are returned
+// as int64 where the version of SQL.js running in the worker supports
+// BigInts.
+func (d *WorkerDatabase) Exec(ctx context.Context, query string) ([]Result, int64, error) {
+	reply, err := d.send(ctx, query, map[string]interface{}{"action": "exec", "sql": query})
+	if err != nil {
+		return nil, 0, err
+	}
+	results := reply.Get("results")
+	r := make([]Result, results.Length())
+	for i := range r {
+		r[i] = workerResult(results.Index(i).Get("columns"), results.Index(i).Get("values"))
+	}
+	return r, rowsModified(reply), nil
+}
+
+// Run executes one or more SQL statements, ignoring any rows they return, and
+// returns the number of rows modified, inserted or deleted by the last
+// INSERT, UPDATE or DELETE statement.
+func (d *WorkerDatabase) Run(ctx context.Context, query string) (int64, error) {
+	reply, err := d.send(ctx, query, map[string]interface{}{"action": "run", "sql": query})
+	if err != nil {
+		return 0, err
+	}
+	return rowsModified(reply), nil
+}
+
+// RunParams executes a single SQL statement with placeholder parameters,
+// ignoring any rows it returns, and returns the number of rows it modified,
+// inserted or deleted.
+func (d *WorkerDatabase) RunParams(ctx context.Context, query string, params []interface{}) (int64, error) {
+	reply, err := d.send(ctx, query, map[string]interface{}{"action": "run", "sql": query, "params": jsParams(params)})
+	if err != nil {
+		return 0, err
+	}
+	return rowsModified(reply), nil
+}
+
+// rowsModified returns the count of modified rows sent with a reply. It is
+// read from each reply, rather than kept by the WorkerDatabase, as another
+// goroutine's request may complete in between.
+func rowsModified(reply jsObject) int64 {
+	if n := reply.Get("rowsModified"); !isNil(n) {
+		return int64(n.Float())
+	}
+	return 0
+}
+
+// Query executes a single SQL statement with placeholder parameters, and
+// returns all of the rows it produces. params may be nil, a []interface{} or
+// a map[string]interface{}, as for Statement.Bind() and BindNamed().
+func (d *WorkerDatabase) Query(ctx context.Context, query string, params interface{}) (*Result, error) {
+	reply, err := d.send(ctx, query, map[string]interface{}{"action": "query", "sql": query, "params": jsParams(params)})
+	if err != nil {
+		return nil, err
+	}
+	r := workerResult(reply.Get("columns"), reply.Get("values"))
+	return &r, nil
+}
+
+func workerResult(cols, rows jsObject) Result {
+	var r Result
+	r.Columns = make([]string, cols.Length())
+	for j := range r.Columns {
+		r.Columns[j] = cols.Index(j).String()
+	}
+	r.Values = make([][]interface{}, rows.Length())
+	for j := range r.Values {
+		vals := rows.Index(j)
+		r.Values[j] = make([]interface{}, vals.Length())
+		for k := range r.Values[j] {
+			r.Values[j][k] = goValue(vals.Index(k))
+		}
+	}
+	return r
+}
+
+// Export returns the contents of the database.
+func (d *WorkerDatabase) Export(ctx context.Context) (io.Reader, error) {
+	reply, err := d.send(ctx, "", map[string]interface{}{"action": "export"})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(goValue(reply.Get("buffer")).([]byte)), nil
+}
+
+// Close closes the database, and terminates the worker.
+func (d *WorkerDatabase) Close(ctx context.Context) error {
+	_, err := d.send(ctx, "", map[string]interface{}{"action": "close"})
+	if err == ErrWorkerClosed {
+		return nil
+	}
+	d.terminate()
+	return err
+}
+
+func (d *WorkerDatabase) terminate() {
+	d.fail(ErrWorkerClosed)
+	d.worker.Call("terminate")
+	for _, release := range d.release {
+		release()
+	}
+	d.release = nil
+}
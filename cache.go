@@ -0,0 +1,156 @@
+package sqljs
+
+import (
+	"container/list"
+)
+
+// DefaultStatementCacheSize is the number of prepared statements cached per
+// connection when SQLJSDriver.StatementCacheSize is 0.
+const DefaultStatementCacheSize = 32
+
+// CacheStats reports the activity of a connection's prepared statement cache.
+type CacheStats struct {
+	// Hits is the number of Prepare() calls served from the cache.
+	Hits int64
+	// Misses is the number of Prepare() calls which compiled a new statement.
+	Misses int64
+	// Evictions is the number of statements freed to make room for others.
+	Evictions int64
+	// Invalidations is the number of times the cache was flushed because
+	// the database schema changed.
+	Invalidations int64
+	// Size is the number of idle statements currently cached.
+	Size int
+}
+
+// stmtCache is a bounded LRU cache of idle prepared statements, keyed by
+// their SQL text. Statements are removed from the cache while in use, and
+// returned to it when closed.
+type stmtCache struct {
+	db      BackendDatabase
+	size    int
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[string]*list.Element
+	stats   CacheStats
+
+	schemaStmt    BackendStatement
+	schemaVersion int64
+}
+
+type cacheEntry struct {
+	query string
+	stmt  BackendStatement
+}
+
+func newStmtCache(db BackendDatabase, size int) *stmtCache {
+	return &stmtCache{
+		db:            db,
+		size:          size,
+		lru:           list.New(),
+		entries:       make(map[string]*list.Element),
+		schemaVersion: -1,
+	}
+}
+
+// get returns an idle statement for query, removing it from the cache, or
+// nil if none is cached.
+func (c *stmtCache) get(query string) BackendStatement {
+	c.checkSchema()
+	e, ok := c.entries[query]
+	if !ok {
+		c.stats.Misses++
+		return nil
+	}
+	c.stats.Hits++
+	c.lru.Remove(e)
+	delete(c.entries, query)
+	return e.Value.(*cacheEntry).stmt
+}
+
+// put returns a statement to the cache, freeing it instead if a statement for
+// the same query is already cached, or if the schema has changed since the
+// statement was prepared, at schema version version. The least recently used
+// statement is evicted if the cache is full.
+func (c *stmtCache) put(query string, s BackendStatement, version int64) error {
+	if c.db == nil {
+		return s.Free()
+	}
+	c.checkSchema()
+	if _, ok := c.entries[query]; ok || version != c.schemaVersion {
+		return s.Free()
+	}
+	if err := s.Reset(); err != nil {
+		s.Free()
+		return err
+	}
+	c.entries[query] = c.lru.PushFront(&cacheEntry{query, s})
+	for c.lru.Len() > c.size {
+		c.evict(c.lru.Back())
+		c.stats.Evictions++
+	}
+	return nil
+}
+
+func (c *stmtCache) evict(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	delete(c.entries, entry.query)
+	entry.stmt.Free()
+}
+
+// checkSchema flushes the cache if the schema version of the database has
+// changed since the last check.
+func (c *stmtCache) checkSchema() {
+	if c.schemaStmt == nil {
+		s, err := c.db.Prepare("PRAGMA schema_version")
+		if err != nil {
+			return
+		}
+		c.schemaStmt = s
+	}
+	defer c.schemaStmt.Reset()
+	if ok, err := c.schemaStmt.Step(); err != nil || !ok {
+		return
+	}
+	row, err := c.schemaStmt.Get()
+	if err != nil || len(row) == 0 {
+		return
+	}
+	var version int64
+	switch v := row[0].(type) {
+	case int64:
+		version = v
+	case float64:
+		version = int64(v)
+	}
+	if version != c.schemaVersion {
+		if c.schemaVersion != -1 && c.lru.Len() > 0 {
+			c.stats.Invalidations++
+		}
+		c.flush()
+		c.schemaVersion = version
+	}
+}
+
+// flush frees all cached statements.
+func (c *stmtCache) flush() {
+	for c.lru.Len() > 0 {
+		c.evict(c.lru.Back())
+	}
+}
+
+// close frees all cached statements. Statements returned to the cache after
+// it has been closed are freed immediately.
+func (c *stmtCache) close() {
+	c.flush()
+	if c.schemaStmt != nil {
+		c.schemaStmt.Free()
+		c.schemaStmt = nil
+	}
+	c.db = nil
+}
+
+func (c *stmtCache) statistics() CacheStats {
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
@@ -0,0 +1,182 @@
+package changelog
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/flimzy/go-sql.js/schema"
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// Apply makes the row identified by c.Key hold the values in c.New, inserting
+// it if necessary, or deletes it if c.New is nil. c.Old is ignored, so a
+// change may be applied to a database whose copy of the row has diverged.
+//
+// Columns missing from c.New are left unchanged, or take their default
+// values when the row is inserted. Strings are decoded as hex for columns
+// whose declared type contains BLOB, reversing the encoding used when the
+// change was recorded.
+//
+// If the table is tracked, applying the change records a new change. Use
+// LastSeq and Discard to prevent this.
+func Apply(tx *sql.Tx, c Change) error {
+	cols, err := schema.Columns(tx, c.Table)
+	if err != nil {
+		return err
+	}
+	blobs := make(map[string]bool)
+	var pk []schema.Column
+	for _, col := range cols {
+		if strings.Contains(strings.ToUpper(col.Type), "BLOB") {
+			blobs[col.Name] = true
+		}
+		if col.PrimaryKey > 0 {
+			pk = append(pk, col)
+		}
+	}
+	sort.Slice(pk, func(i, j int) bool { return pk[i].PrimaryKey < pk[j].PrimaryKey })
+	keyCols := []string{"rowid"}
+	if len(pk) > 0 {
+		keyCols = make([]string, len(pk))
+		for i, col := range pk {
+			keyCols[i] = col.Name
+		}
+	}
+
+	var key []interface{}
+	if err := decodeJSON(c.Key, &key); err != nil {
+		return fmt.Errorf("changelog: invalid key %s: %w", c.Key, err)
+	}
+	if len(key) != len(keyCols) {
+		return fmt.Errorf("changelog: key %s does not match primary key of %s", c.Key, c.Table)
+	}
+	where := make([]string, len(keyCols))
+	keyArgs := make([]interface{}, len(keyCols))
+	for i, name := range keyCols {
+		where[i] = ident(name) + " = ?"
+		keyArgs[i] = columnValue(key[i], blobs[name])
+	}
+	table := script.QuoteIdent(c.Table)
+	if c.New == nil {
+		_, err := tx.Exec("DELETE FROM "+table+" WHERE "+strings.Join(where, " AND "), keyArgs...)
+		return err
+	}
+
+	var row map[string]interface{}
+	if err := decodeJSON(c.New, &row); err != nil {
+		return fmt.Errorf("changelog: invalid row %s: %w", c.New, err)
+	}
+	var set, names, params []string
+	var args []interface{}
+	for _, col := range cols {
+		v, ok := row[col.Name]
+		if !ok {
+			continue
+		}
+		set = append(set, script.QuoteIdent(col.Name)+" = ?")
+		names = append(names, script.QuoteIdent(col.Name))
+		params = append(params, "?")
+		args = append(args, columnValue(v, blobs[col.Name]))
+	}
+	if len(set) > 0 {
+		res, err := tx.Exec("UPDATE "+table+" SET "+strings.Join(set, ", ")+" WHERE "+strings.Join(where, " AND "),
+			append(args, keyArgs...)...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			return nil
+		}
+	}
+	if len(pk) == 0 {
+		names = append(names, "rowid")
+		params = append(params, "?")
+		args = append(args, keyArgs[0])
+	}
+	_, err = tx.Exec("INSERT INTO "+table+" ("+strings.Join(names, ", ")+") VALUES ("+strings.Join(params, ", ")+")", args...)
+	return err
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// columnValue converts a decoded JSON value to an SQL value.
+func columnValue(v interface{}, blob bool) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case string:
+		if blob {
+			if b, err := hex.DecodeString(t); err == nil {
+				return b
+			}
+		}
+		return t
+	case bool:
+		if t {
+			return int64(1)
+		}
+		return int64(0)
+	case nil:
+		return nil
+	}
+	// Nested arrays and objects are stored as JSON text.
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func ident(name string) string {
+	if name == "rowid" {
+		return name
+	}
+	return script.QuoteIdent(name)
+}
+
+// LastSeq returns the Seq of the most recently recorded change, or 0 if no
+// changes have been recorded.
+func (l *Log) LastSeq(tx *sql.Tx) (int64, error) {
+	if err := l.init(tx); err != nil {
+		return 0, err
+	}
+	var seq sql.NullInt64
+	err := tx.QueryRow("SELECT MAX(seq) FROM " + script.QuoteIdent(l.table())).Scan(&seq)
+	return seq.Int64, err
+}
+
+// Discard deletes the changes recorded after seq. Together with LastSeq, it
+// allows changes to be made without recording them:
+//
+//    seq, err := log.LastSeq(tx)
+//    ...
+//    err = changelog.Apply(tx, remoteChange)
+//    ...
+//    err = log.Discard(tx, seq)
+func (l *Log) Discard(tx *sql.Tx, seq int64) error {
+	_, err := tx.Exec("DELETE FROM "+script.QuoteIdent(l.table())+" WHERE seq > ?", seq)
+	return err
+}
+
+// Remove deletes the changes with the given sequence numbers.
+func (l *Log) Remove(tx *sql.Tx, seqs ...int64) error {
+	if len(seqs) == 0 {
+		return nil
+	}
+	list := make([]string, len(seqs))
+	for i, seq := range seqs {
+		list[i] = fmt.Sprint(seq)
+	}
+	_, err := tx.Exec("DELETE FROM " + script.QuoteIdent(l.table()) + " WHERE seq IN (" + strings.Join(list, ", ") + ")")
+	return err
+}
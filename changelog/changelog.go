@@ -0,0 +1,398 @@
+// Package changelog records changes to tables of an SQLite database, such as
+// one opened with the sqljs driver, so they can be sent elsewhere, for example
+// to synchronize edits made in a browser-side database with a server.
+//
+// Tracking a table installs triggers which record every INSERT, UPDATE and
+// DELETE in a changelog table, with the values of the row before and after
+// the change encoded as JSON objects. Changes are read with Pending(),
+// marked as delivered with Ack(), and removed with Compact().
+//
+//	log := &changelog.Log{DB: db}
+//	if err := log.Track("todos"); err != nil {
+//	    return err
+//	}
+//	...
+//	changes, err := log.Pending(100)
+//	// send changes to the server
+//	err = log.Ack(changes[len(changes)-1].Seq)
+//
+// The JSON1 functions must be available, as they are in sql.js. BLOB values
+// are recorded as hex-encoded strings, since JSON cannot represent them.
+package changelog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flimzy/go-sql.js/schema"
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// DefaultTable is the name of the changelog table used when Log.Table is
+// empty.
+const DefaultTable = "_changelog"
+
+// Op is the kind of a change.
+type Op string
+
+// The kinds of changes.
+const (
+	Insert Op = "INSERT"
+	Update Op = "UPDATE"
+	Delete Op = "DELETE"
+)
+
+// Change is a recorded change to a row.
+type Change struct {
+	// Seq is the position of the change in the changelog. It increases
+	// with every change.
+	Seq   int64
+	Table string
+	Op    Op
+	// Key is a JSON array of the primary key values of the row, or of its
+	// rowid for tables without a primary key. An update which changes the
+	// key is recorded as a delete followed by an insert.
+	Key json.RawMessage
+	// Old and New are JSON objects mapping column names to the values of
+	// the row before and after the change. Old is nil for inserts, and New
+	// is nil for deletes.
+	Old, New json.RawMessage
+	Time     time.Time
+	// Acked is true once the change has been acknowledged.
+	Acked bool
+}
+
+// Log records changes to tables in a changelog table.
+type Log struct {
+	// DB is the database whose changes are recorded.
+	DB *sql.DB
+	// Table is the name of the changelog table, which is created if
+	// necessary. It defaults to DefaultTable. Triggers installed by Track
+	// are named after it.
+	Table string
+}
+
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (l *Log) table() string {
+	if l.Table == "" {
+		return DefaultTable
+	}
+	return l.Table
+}
+
+// Init creates the changelog table, if it does not already exist. It is
+// called by Track, so need not normally be called directly.
+func (l *Log) Init() error {
+	return l.init(l.DB)
+}
+
+func (l *Log) init(q queryer) error {
+	_, err := q.Exec("CREATE TABLE IF NOT EXISTS " + script.QuoteIdent(l.table()) + ` (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	tbl TEXT NOT NULL,
+	op TEXT NOT NULL,
+	row_key TEXT NOT NULL,
+	old TEXT,
+	new TEXT,
+	time TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+	acked INTEGER NOT NULL DEFAULT 0
+)`)
+	return err
+}
+
+func (l *Log) triggerName(table, event string) string {
+	return l.table() + "_" + table + "_" + event
+}
+
+var events = []string{"insert", "update", "rekey", "delete"}
+
+// Track installs triggers which record changes to the named tables. Tracking
+// a table which is already tracked reinstalls its triggers, which is
+// necessary after columns have been added to it.
+func (l *Log) Track(tables ...string) (err error) {
+	tx, err := l.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	if err := l.init(tx); err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if err := l.track(tx, table); err != nil {
+			return fmt.Errorf("changelog: track %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (l *Log) track(tx *sql.Tx, table string) error {
+	if err := l.untrack(tx, table); err != nil {
+		return err
+	}
+	cols, err := schema.Columns(tx, table)
+	if err != nil {
+		return err
+	}
+	var pk []string
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.Name
+		if c.PrimaryKey > 0 {
+			if len(pk) < c.PrimaryKey {
+				pk = append(pk, make([]string, c.PrimaryKey-len(pk))...)
+			}
+			pk[c.PrimaryKey-1] = c.Name
+		}
+	}
+	if len(pk) == 0 {
+		pk = []string{"rowid"}
+	}
+	log, tbl := script.QuoteIdent(l.table()), script.Literal(table)
+	oldKey, newKey := keyJSON("OLD", pk), keyJSON("NEW", pk)
+	oldRow, newRow := rowJSON("OLD", names), rowJSON("NEW", names)
+	insert := func(op Op, key, old, new string) string {
+		return fmt.Sprintf("INSERT INTO %s (tbl, op, row_key, old, new) VALUES (%s, '%s', %s, %s, %s);",
+			log, tbl, op, key, old, new)
+	}
+	triggers := map[string]string{
+		"insert": "AFTER INSERT ON %s BEGIN " + insert(Insert, newKey, "NULL", newRow) + " END",
+		"update": "AFTER UPDATE ON %s WHEN " + oldKey + " IS " + newKey + " AND " + oldRow + " IS NOT " + newRow +
+			" BEGIN " + insert(Update, newKey, oldRow, newRow) + " END",
+		"rekey": "AFTER UPDATE ON %s WHEN " + oldKey + " IS NOT " + newKey +
+			" BEGIN " + insert(Delete, oldKey, oldRow, "NULL") + " " + insert(Insert, newKey, "NULL", newRow) + " END",
+		"delete": "AFTER DELETE ON %s BEGIN " + insert(Delete, oldKey, oldRow, "NULL") + " END",
+	}
+	for _, event := range events {
+		query := "CREATE TRIGGER " + script.QuoteIdent(l.triggerName(table, event)) + " " +
+			fmt.Sprintf(triggers[event], script.QuoteIdent(table))
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func value(row, col string) string {
+	if col != "rowid" {
+		col = script.QuoteIdent(col)
+	}
+	v := row + "." + col
+	return "CASE WHEN typeof(" + v + ") = 'blob' THEN hex(" + v + ") ELSE " + v + " END"
+}
+
+func keyJSON(row string, pk []string) string {
+	values := make([]string, len(pk))
+	for i, col := range pk {
+		values[i] = value(row, col)
+	}
+	return "json_array(" + strings.Join(values, ", ") + ")"
+}
+
+func rowJSON(row string, cols []string) string {
+	args := make([]string, 0, 2*len(cols))
+	for _, col := range cols {
+		args = append(args, script.Literal(col), value(row, col))
+	}
+	return "json_object(" + strings.Join(args, ", ") + ")"
+}
+
+// Untrack removes the triggers installed by Track from the named tables.
+// Changes which have already been recorded are kept.
+func (l *Log) Untrack(tables ...string) error {
+	for _, table := range tables {
+		if err := l.untrack(l.DB, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Log) untrack(q queryer, table string) error {
+	for _, event := range events {
+		if _, err := q.Exec("DROP TRIGGER IF EXISTS " + script.QuoteIdent(l.triggerName(table, event))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tracked returns the names of the tables whose changes are recorded.
+func (l *Log) Tracked() ([]string, error) {
+	rows, err := l.DB.Query("SELECT name, tbl_name FROM sqlite_master WHERE type = 'trigger' ORDER BY tbl_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var name, table string
+		if err := rows.Scan(&name, &table); err != nil {
+			return nil, err
+		}
+		if name == l.triggerName(table, "insert") {
+			tables = append(tables, table)
+		}
+	}
+	return tables, rows.Err()
+}
+
+const selectChanges = "SELECT seq, tbl, op, row_key, old, new, time, acked FROM "
+
+func scanChanges(rows *sql.Rows) ([]Change, error) {
+	defer rows.Close()
+	var changes []Change
+	for rows.Next() {
+		var c Change
+		var old, new sql.NullString
+		var key, ts string
+		if err := rows.Scan(&c.Seq, &c.Table, &c.Op, &key, &old, &new, &ts, &c.Acked); err != nil {
+			return nil, err
+		}
+		c.Key = json.RawMessage(key)
+		if old.Valid {
+			c.Old = json.RawMessage(old.String)
+		}
+		if new.Valid {
+			c.New = json.RawMessage(new.String)
+		}
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return nil, fmt.Errorf("changelog: invalid time for change %d: %w", c.Seq, err)
+		}
+		c.Time = t
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// Pending returns up to limit unacknowledged changes, oldest first. If limit
+// is 0, all unacknowledged changes are returned.
+func (l *Log) Pending(limit int) ([]Change, error) {
+	return l.pending(l.DB, limit)
+}
+
+func (l *Log) pending(q queryer, limit int) ([]Change, error) {
+	if err := l.init(q); err != nil {
+		return nil, err
+	}
+	query := selectChanges + script.QuoteIdent(l.table()) + " WHERE acked = 0 ORDER BY seq"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	return scanChanges(rows)
+}
+
+// Ack acknowledges all changes up to and including seq, so they are no
+// longer returned by Pending.
+func (l *Log) Ack(seq int64) error {
+	if err := l.Init(); err != nil {
+		return err
+	}
+	_, err := l.DB.Exec("UPDATE "+script.QuoteIdent(l.table())+" SET acked = 1 WHERE seq <= ? AND acked = 0", seq)
+	return err
+}
+
+// Compact deletes acknowledged changes, and merges the pending changes to
+// each row into a single change. For example, an insert followed by updates
+// becomes a single insert of the final values, and an insert followed by a
+// delete is removed altogether. Merged changes keep the Seq of the latest
+// change they replace.
+func (l *Log) Compact() (err error) {
+	tx, err := l.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	log := script.QuoteIdent(l.table())
+	if _, err := tx.Exec("DELETE FROM " + log + " WHERE acked = 1"); err != nil {
+		return err
+	}
+	changes, err := l.pending(tx, 0)
+	if err != nil {
+		return err
+	}
+	type rowID struct{ table, key string }
+	groups := make(map[rowID][]Change)
+	var order []rowID
+	for _, c := range changes {
+		id := rowID{c.Table, string(c.Key)}
+		if _, ok := groups[id]; !ok {
+			order = append(order, id)
+		}
+		groups[id] = append(groups[id], c)
+	}
+	for _, id := range order {
+		group := groups[id]
+		if len(group) == 1 {
+			continue
+		}
+		last := group[len(group)-1]
+		seqs := make([]int64, len(group)-1)
+		for i, c := range group[:len(group)-1] {
+			seqs[i] = c.Seq
+		}
+		if err := l.Remove(tx, seqs...); err != nil {
+			return err
+		}
+		merged, ok := merge(group)
+		if !ok {
+			err = l.Remove(tx, last.Seq)
+		} else {
+			_, err = tx.Exec("UPDATE "+log+" SET op = ?, old = ?, new = ? WHERE seq = ?",
+				merged.Op, nullJSON(merged.Old), nullJSON(merged.New), last.Seq)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge combines consecutive changes to a single row. It returns false if
+// the changes cancel out.
+func merge(group []Change) (Change, bool) {
+	first, last := group[0], group[len(group)-1]
+	merged := last
+	switch {
+	case first.Op == Insert && last.Op == Delete:
+		return Change{}, false
+	case first.Op == Insert:
+		merged.Op, merged.Old = Insert, nil
+	case last.Op == Delete:
+		merged.Old = first.Old
+	default:
+		merged.Op, merged.Old = Update, first.Old
+	}
+	return merged, true
+}
+
+func nullJSON(data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
@@ -0,0 +1,152 @@
+// +build js
+
+package changelog
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/flimzy/go-sql.js"
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+func testLog(t *testing.T) (*Log, func()) {
+	bdb := bindings.New()
+	if err := bdb.Run(`CREATE TABLE todos (id INTEGER PRIMARY KEY, title TEXT, done INTEGER DEFAULT 0, data BLOB);
+CREATE TABLE notes (body TEXT)`); err != nil {
+		t.Fatalf("Error creating schema: %s", err)
+	}
+	db := sqljs.OpenDB(bdb)
+	log := &Log{DB: db}
+	if err := log.Track("todos", "notes"); err != nil {
+		t.Fatalf("Error tracking tables: %s", err)
+	}
+	return log, func() {
+		db.Close()
+		bdb.Close()
+	}
+}
+
+func decode(t *testing.T, data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("Invalid JSON %s: %s", data, err)
+	}
+	return v
+}
+
+func TestTrack(t *testing.T) {
+	log, done := testLog(t)
+	defer done()
+
+	_, err := log.DB.Exec(`INSERT INTO todos (id, title, data) VALUES (1, 'write tests', x'00ff');
+UPDATE todos SET done = 1 WHERE id = 1;
+UPDATE todos SET done = 1 WHERE id = 1;
+UPDATE todos SET id = 2 WHERE id = 1;
+INSERT INTO notes VALUES ('hello');
+DELETE FROM todos`)
+	if err != nil {
+		t.Fatalf("Error modifying tables: %s", err)
+	}
+	changes, err := log.Pending(0)
+	if err != nil {
+		t.Fatalf("Error reading changes: %s", err)
+	}
+	type change struct {
+		Table    string
+		Op       Op
+		Key      interface{}
+		Old, New interface{}
+	}
+	row := func(id float64, done float64) map[string]interface{} {
+		return map[string]interface{}{"id": id, "title": "write tests", "done": done, "data": "00FF"}
+	}
+	expected := []change{
+		{"todos", Insert, []interface{}{1.0}, nil, row(1, 0)},
+		{"todos", Update, []interface{}{1.0}, row(1, 0), row(1, 1)},
+		{"todos", Delete, []interface{}{1.0}, row(1, 1), nil},
+		{"todos", Insert, []interface{}{2.0}, nil, row(2, 1)},
+		{"notes", Insert, []interface{}{1.0}, nil, map[string]interface{}{"body": "hello"}},
+		{"todos", Delete, []interface{}{2.0}, row(2, 1), nil},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %d: %+v", len(expected), len(changes), changes)
+	}
+	for i, c := range changes {
+		got := change{c.Table, c.Op, decode(t, c.Key), decode(t, c.Old), decode(t, c.New)}
+		if !reflect.DeepEqual(got, expected[i]) {
+			t.Errorf("Change %d: expected %+v, got %+v", i, expected[i], got)
+		}
+		if i > 0 && c.Seq <= changes[i-1].Seq {
+			t.Errorf("Change %d: sequence not increasing", i)
+		}
+	}
+
+	tracked, err := log.Tracked()
+	if err != nil {
+		t.Fatalf("Error listing tracked tables: %s", err)
+	}
+	if !reflect.DeepEqual(tracked, []string{"notes", "todos"}) {
+		t.Errorf("Unexpected tracked tables: %v", tracked)
+	}
+	if err := log.Untrack("notes"); err != nil {
+		t.Fatalf("Error untracking: %s", err)
+	}
+	if _, err := log.DB.Exec("INSERT INTO notes VALUES ('untracked')"); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	if after, _ := log.Pending(0); len(after) != len(changes) {
+		t.Errorf("Untracked table still recorded changes")
+	}
+}
+
+func TestAckCompact(t *testing.T) {
+	log, done := testLog(t)
+	defer done()
+
+	_, err := log.DB.Exec(`INSERT INTO todos (id, title) VALUES (1, 'a'), (2, 'b'), (3, 'c');
+UPDATE todos SET title = 'b2' WHERE id = 2;
+DELETE FROM todos WHERE id = 1;
+UPDATE todos SET title = 'c2' WHERE id = 3`)
+	if err != nil {
+		t.Fatalf("Error modifying table: %s", err)
+	}
+	changes, err := log.Pending(1)
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("Expected 1 change, got %v, %v", changes, err)
+	}
+	// Acknowledge the insert of row 1.
+	if err := log.Ack(changes[0].Seq); err != nil {
+		t.Fatalf("Error acknowledging: %s", err)
+	}
+	if err := log.Compact(); err != nil {
+		t.Fatalf("Error compacting: %s", err)
+	}
+	changes, err = log.Pending(0)
+	if err != nil {
+		t.Fatalf("Error reading changes: %s", err)
+	}
+	// The inserts and updates of rows 2 and 3 are merged, and the delete of
+	// row 1 remains, since its insert was already acknowledged.
+	type change struct {
+		Op    Op
+		Key   string
+		Title interface{}
+	}
+	var got []change
+	for _, c := range changes {
+		var title interface{}
+		if c.New != nil {
+			title = decode(t, c.New).(map[string]interface{})["title"]
+		}
+		got = append(got, change{c.Op, string(c.Key), title})
+	}
+	expected := []change{{Insert, "[2]", "b2"}, {Delete, "[1]", nil}, {Insert, "[3]", "c2"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected changes after compaction: %+v", got)
+	}
+}
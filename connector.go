@@ -0,0 +1,35 @@
+// +build js
+
+package sqljs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+type connector struct {
+	db     *bindings.Database
+	driver *SQLJSDriver
+}
+
+func (c *connector) Connect(_ context.Context) (driver.Conn, error) {
+	conn := c.driver.newConn(&sqljsDatabase{c.db})
+	conn.borrowed = true
+	return conn, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// OpenDB returns a *sql.DB which uses the already-open database db, so that
+// packages built on database/sql may be used with a bindings.Database. The
+// returned *sql.DB uses a single connection. Closing it does not close db.
+func OpenDB(db *bindings.Database) *sql.DB {
+	sqlDB := sql.OpenDB(&connector{db: db, driver: &SQLJSDriver{}})
+	sqlDB.SetMaxOpenConns(1)
+	return sqlDB
+}
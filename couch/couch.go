@@ -0,0 +1,562 @@
+// Package couch replicates a table of an SQLite database, such as one opened
+// with the sqljs driver, with a database on a server speaking the CouchDB
+// replication API.
+//
+// Each row maps to a document whose _id is the row's primary key, or its
+// rowid if the table has no primary key, and whose other fields are the
+// row's columns. Tables with composite primary keys are not supported. BLOB
+// values are encoded as hex strings, as in the changelog package.
+//
+// Pull reads the server's _changes feed and applies new revisions to the
+// table. Push sends local changes, captured by a changelog.Log tracking the
+// table, with _bulk_docs. The revision of each document is recorded in a side
+// table, so that pushed updates replace the revision the row was last
+// synchronized with.
+//
+//    r := &couch.Replicator{
+//        Log:   log,
+//        URL:   "https://couch.example.com/todos",
+//        Table: "todos",
+//    }
+//    err := r.Replicate(ctx)
+package couch
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/go-sql.js/changelog"
+	"github.com/flimzy/go-sql.js/schema"
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// DefaultRevTable is the name of the table in which document revisions are
+// recorded, when Replicator.RevTable is empty.
+const DefaultRevTable = "_couch_revs"
+
+// DefaultBatchSize is the number of documents transferred per request when
+// Replicator.BatchSize is 0.
+const DefaultBatchSize = 100
+
+// ConflictError is returned by Push when the server rejected updates to
+// documents because they were changed remotely since they were last pulled.
+// The local changes are kept, and Pull resolves the conflicts.
+type ConflictError struct {
+	IDs []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("couch: %d document update conflicts", len(e.IDs))
+}
+
+// SkippedError is returned by Pull when documents could not be applied
+// because their IDs are not integers, and the table's primary key is an
+// INTEGER column (or the rowid). The other documents are still applied, and
+// the skipped documents are not pulled again unless they change.
+type SkippedError struct {
+	IDs []string
+}
+
+func (e *SkippedError) Error() string {
+	return fmt.Sprintf("couch: %d documents skipped, as their IDs are not integers", len(e.IDs))
+}
+
+// Replicator replicates a table with a CouchDB database.
+type Replicator struct {
+	// Log records local changes, which are pushed to the server. It must
+	// track Table.
+	Log *changelog.Log
+	// URL is the URL of the CouchDB database, such as
+	// http://localhost:5984/todos.
+	URL string
+	// Table is the replicated table.
+	Table string
+	// HTTPClient is used to make requests. It defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+	// LocalWins causes pending local changes to take precedence over remote
+	// revisions of the same document when pulling; the local change is then
+	// pushed as a new revision of the document. Otherwise, the remote
+	// revision replaces the local row and the local change is discarded.
+	LocalWins bool
+	// BatchSize is the maximum number of documents per request. It defaults
+	// to DefaultBatchSize.
+	BatchSize int
+	// RevTable is the name of the table in which document revisions and the
+	// last pulled sequence are recorded. It defaults to DefaultRevTable.
+	RevTable string
+}
+
+func (r *Replicator) revTable() string {
+	if r.RevTable == "" {
+		return DefaultRevTable
+	}
+	return r.RevTable
+}
+
+func (r *Replicator) checkpointTable() string {
+	return r.revTable() + "_checkpoints"
+}
+
+func (r *Replicator) batchSize() int {
+	if r.BatchSize > 0 {
+		return r.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (r *Replicator) init(e execer) error {
+	_, err := e.Exec("CREATE TABLE IF NOT EXISTS " + script.QuoteIdent(r.revTable()) +
+		" (tbl TEXT NOT NULL, doc_id TEXT NOT NULL, rev TEXT NOT NULL, PRIMARY KEY (tbl, doc_id))")
+	if err != nil {
+		return err
+	}
+	_, err = e.Exec("CREATE TABLE IF NOT EXISTS " + script.QuoteIdent(r.checkpointTable()) +
+		" (url TEXT NOT NULL, tbl TEXT NOT NULL, since TEXT NOT NULL, PRIMARY KEY (url, tbl))")
+	return err
+}
+
+// Rev returns the revision of the document with the given ID the table was
+// last synchronized with, or "" if it has never been synchronized.
+func (r *Replicator) Rev(id string) (string, error) {
+	if err := r.init(r.Log.DB); err != nil {
+		return "", err
+	}
+	var rev string
+	err := r.Log.DB.QueryRow("SELECT rev FROM "+script.QuoteIdent(r.revTable())+" WHERE tbl = ? AND doc_id = ?", r.Table, id).Scan(&rev)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return rev, err
+}
+
+func (r *Replicator) setRev(e execer, id, rev string) error {
+	_, err := e.Exec("INSERT OR REPLACE INTO "+script.QuoteIdent(r.revTable())+" (tbl, doc_id, rev) VALUES (?, ?, ?)", r.Table, id, rev)
+	return err
+}
+
+func (r *Replicator) since() (string, error) {
+	if err := r.init(r.Log.DB); err != nil {
+		return "", err
+	}
+	var since string
+	err := r.Log.DB.QueryRow("SELECT since FROM "+script.QuoteIdent(r.checkpointTable())+" WHERE url = ? AND tbl = ?", r.URL, r.Table).Scan(&since)
+	if err == sql.ErrNoRows {
+		return "0", nil
+	}
+	return since, err
+}
+
+// idColumn returns the column holding document IDs, and whether IDs are
+// integers.
+func (r *Replicator) idColumn(q schema.Querier) (string, bool, error) {
+	cols, err := schema.Columns(q, r.Table)
+	if err != nil {
+		return "", false, err
+	}
+	var pk []schema.Column
+	for _, c := range cols {
+		if c.PrimaryKey > 0 {
+			pk = append(pk, c)
+		}
+	}
+	switch len(pk) {
+	case 0:
+		return "rowid", true, nil
+	case 1:
+		return pk[0].Name, strings.Contains(strings.ToUpper(pk[0].Type), "INT"), nil
+	}
+	return "", false, fmt.Errorf("couch: table %s has a composite primary key", r.Table)
+}
+
+// docID converts a changelog key to a document ID.
+func docID(key json.RawMessage) (string, error) {
+	var values []interface{}
+	dec := json.NewDecoder(bytes.NewReader(key))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil || len(values) != 1 {
+		return "", fmt.Errorf("couch: unsupported key %s", key)
+	}
+	switch v := values[0].(type) {
+	case json.Number:
+		return v.String(), nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("couch: unsupported key %s", key)
+}
+
+// rowKey converts a document ID to a changelog key. It returns false if the
+// IDs must be integers, and id is not one.
+func rowKey(id string, integer bool) (json.RawMessage, bool) {
+	if integer {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil || strconv.FormatInt(n, 10) != id {
+			return nil, false
+		}
+		return json.RawMessage("[" + id + "]"), true
+	}
+	data, _ := json.Marshal([]string{id})
+	return data, true
+}
+
+// Replicate pulls remote changes and then pushes local ones. If the push
+// conflicts with remote changes, it pulls and pushes once more. Documents
+// skipped by Pull do not prevent the push; they are reported by a
+// *SkippedError once it succeeds.
+func (r *Replicator) Replicate(ctx context.Context) error {
+	var skipped []string
+	for attempt := 0; ; attempt++ {
+		_, err := r.Pull(ctx)
+		if e, ok := err.(*SkippedError); ok {
+			skipped = append(skipped, e.IDs...)
+		} else if err != nil {
+			return err
+		}
+		_, err = r.Push(ctx)
+		if _, ok := err.(*ConflictError); ok && attempt == 0 {
+			continue
+		}
+		if err == nil && len(skipped) > 0 {
+			return &SkippedError{IDs: skipped}
+		}
+		return err
+	}
+}
+
+type changesResponse struct {
+	Results []struct {
+		Seq     json.RawMessage `json:"seq"`
+		ID      string          `json:"id"`
+		Deleted bool            `json:"deleted"`
+		Doc     json.RawMessage `json:"doc"`
+		Changes []struct {
+			Rev string `json:"rev"`
+		} `json:"changes"`
+	} `json:"results"`
+	LastSeq json.RawMessage `json:"last_seq"`
+}
+
+// seqString converts a sequence, which is a number in CouchDB 1.x and a
+// string in later versions, to a query parameter.
+func seqString(seq json.RawMessage) string {
+	var s string
+	if json.Unmarshal(seq, &s) == nil {
+		return s
+	}
+	return string(seq)
+}
+
+// Pull applies the changes made on the server since the last pull, and
+// returns the number of documents applied. Applying remote changes does not
+// record local changes. If some documents cannot be stored in the table, the
+// others are still applied, and a *SkippedError is returned.
+func (r *Replicator) Pull(ctx context.Context) (int, error) {
+	total := 0
+	var skipped []string
+	for {
+		since, err := r.since()
+		if err != nil {
+			return total, err
+		}
+		query := url.Values{
+			"since":        {since},
+			"include_docs": {"true"},
+			"limit":        {strconv.Itoa(r.batchSize())},
+		}
+		var resp changesResponse
+		if err := r.do(ctx, http.MethodGet, "/_changes?"+query.Encode(), nil, &resp); err != nil {
+			return total, err
+		}
+		if len(resp.Results) == 0 {
+			if len(skipped) > 0 {
+				return total, &SkippedError{IDs: skipped}
+			}
+			return total, nil
+		}
+		n, s, err := r.apply(resp)
+		total += n
+		skipped = append(skipped, s...)
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// apply applies a batch of changes, and returns the number of documents
+// applied and the IDs of those skipped.
+func (r *Replicator) apply(resp changesResponse) (n int, skipped []string, err error) {
+	if err := r.Log.Compact(); err != nil {
+		return 0, nil, err
+	}
+	pending, err := r.Log.Pending(0)
+	if err != nil {
+		return 0, nil, err
+	}
+	local := make(map[string]int64)
+	for _, p := range pending {
+		if p.Table != r.Table {
+			continue
+		}
+		id, err := docID(p.Key)
+		if err != nil {
+			return 0, nil, err
+		}
+		local[id] = p.Seq
+	}
+
+	tx, err := r.Log.DB.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	if err := r.init(tx); err != nil {
+		return 0, nil, err
+	}
+	idCol, integer, err := r.idColumn(tx)
+	if err != nil {
+		return 0, nil, err
+	}
+	mark, err := r.Log.LastSeq(tx)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, result := range resp.Results {
+		if strings.HasPrefix(result.ID, "_design/") || len(result.Changes) == 0 {
+			continue
+		}
+		key, ok := rowKey(result.ID, integer)
+		if !ok {
+			skipped = append(skipped, result.ID)
+			continue
+		}
+		if err := r.setRev(tx, result.ID, result.Changes[0].Rev); err != nil {
+			return n, skipped, err
+		}
+		if seq, ok := local[result.ID]; ok {
+			if r.LocalWins {
+				continue
+			}
+			if err := r.Log.Remove(tx, seq); err != nil {
+				return n, skipped, err
+			}
+		}
+		c := changelog.Change{Table: r.Table, Key: key}
+		if !result.Deleted {
+			if c.New, err = docRow(result.Doc, idCol, c.Key); err != nil {
+				return n, skipped, fmt.Errorf("couch: document %s: %w", result.ID, err)
+			}
+		}
+		if err := changelog.Apply(tx, c); err != nil {
+			return n, skipped, fmt.Errorf("couch: document %s: %w", result.ID, err)
+		}
+		n++
+	}
+	if err := r.Log.Discard(tx, mark); err != nil {
+		return n, skipped, err
+	}
+	_, err = tx.Exec("INSERT OR REPLACE INTO "+script.QuoteIdent(r.checkpointTable())+" (url, tbl, since) VALUES (?, ?, ?)",
+		r.URL, r.Table, seqString(resp.LastSeq))
+	return n, skipped, err
+}
+
+// docRow converts a document to row values, dropping special fields.
+func docRow(doc json.RawMessage, idCol string, key json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, err
+	}
+	for name := range fields {
+		if strings.HasPrefix(name, "_") {
+			delete(fields, name)
+		}
+	}
+	if idCol != "rowid" {
+		fields[idCol] = key[1 : len(key)-1]
+	}
+	return json.Marshal(fields)
+}
+
+type bulkResult struct {
+	ID    string `json:"id"`
+	Rev   string `json:"rev"`
+	Error string `json:"error"`
+}
+
+// Push sends pending local changes to the table to the server, and returns
+// the number of documents updated. If some updates conflict with remote
+// changes, the others are still applied, and a *ConflictError is returned.
+func (r *Replicator) Push(ctx context.Context) (int, error) {
+	if err := r.Log.Compact(); err != nil {
+		return 0, err
+	}
+	pending, err := r.Log.Pending(0)
+	if err != nil {
+		return 0, err
+	}
+	var changes []changelog.Change
+	for _, p := range pending {
+		if p.Table == r.Table {
+			changes = append(changes, p)
+		}
+	}
+	idCol, _, err := r.idColumn(r.Log.DB)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	var conflicts []string
+	for len(changes) > 0 {
+		batch := changes
+		if len(batch) > r.batchSize() {
+			batch = batch[:r.batchSize()]
+		}
+		changes = changes[len(batch):]
+		n, ids, err := r.push(ctx, batch, idCol)
+		total += n
+		conflicts = append(conflicts, ids...)
+		if err != nil {
+			return total, err
+		}
+	}
+	if len(conflicts) > 0 {
+		return total, &ConflictError{IDs: conflicts}
+	}
+	return total, nil
+}
+
+func (r *Replicator) push(ctx context.Context, batch []changelog.Change, idCol string) (int, []string, error) {
+	seqs := make(map[string]int64, len(batch))
+	var docs []map[string]json.RawMessage
+	var skipped []int64
+	for _, c := range batch {
+		id, err := docID(c.Key)
+		if err != nil {
+			return 0, nil, err
+		}
+		rev, err := r.Rev(id)
+		if err != nil {
+			return 0, nil, err
+		}
+		doc := map[string]json.RawMessage{}
+		if c.New == nil {
+			if rev == "" {
+				// The document was never replicated.
+				skipped = append(skipped, c.Seq)
+				continue
+			}
+			doc["_deleted"] = json.RawMessage("true")
+		} else if err := json.Unmarshal(c.New, &doc); err != nil {
+			return 0, nil, err
+		}
+		delete(doc, idCol)
+		doc["_id"], _ = json.Marshal(id)
+		if rev != "" {
+			doc["_rev"], _ = json.Marshal(rev)
+		}
+		seqs[id] = c.Seq
+		docs = append(docs, doc)
+	}
+	var results []bulkResult
+	if len(docs) > 0 {
+		body := map[string]interface{}{"docs": docs}
+		if err := r.do(ctx, http.MethodPost, "/_bulk_docs", body, &results); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	tx, err := r.Log.DB.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := r.init(tx); err != nil {
+		tx.Rollback()
+		return 0, nil, err
+	}
+	n := 0
+	var conflicts []string
+	done := skipped
+	for _, result := range results {
+		seq, ok := seqs[result.ID]
+		switch {
+		case !ok:
+			continue
+		case result.Error == "conflict":
+			conflicts = append(conflicts, result.ID)
+			continue
+		case result.Error != "":
+			tx.Rollback()
+			return 0, nil, fmt.Errorf("couch: document %s: %s", result.ID, result.Error)
+		}
+		if err := r.setRev(tx, result.ID, result.Rev); err != nil {
+			tx.Rollback()
+			return 0, nil, err
+		}
+		done = append(done, seq)
+		n++
+	}
+	if err := r.Log.Remove(tx, done...); err != nil {
+		tx.Rollback()
+		return 0, nil, err
+	}
+	return n, conflicts, tx.Commit()
+}
+
+func (r *Replicator) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(r.URL, "/")+path, rd)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := r.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error  string `json:"error"`
+			Reason string `json:"reason"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		if e.Error == "" {
+			e.Error = resp.Status
+		}
+		return fmt.Errorf("couch: %s %s: %s %s", method, path, e.Error, e.Reason)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
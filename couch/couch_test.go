@@ -0,0 +1,268 @@
+// +build js
+
+package couch
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flimzy/go-sql.js/internal/synctest"
+)
+
+// couchServer is a minimal in-process stand-in for a CouchDB database,
+// supporting _changes and _bulk_docs.
+type couchServer struct {
+	mu   sync.Mutex
+	seq  int
+	docs map[string]*couchDoc
+}
+
+type couchDoc struct {
+	rev     string
+	seq     int
+	deleted bool
+	body    map[string]interface{}
+}
+
+func newCouchServer() *couchServer {
+	return &couchServer{docs: map[string]*couchDoc{}}
+}
+
+// put stores a document, returning an error string on conflict.
+func (s *couchServer) put(body map[string]interface{}) (string, string) {
+	id, _ := body["_id"].(string)
+	rev, _ := body["_rev"].(string)
+	existing := s.docs[id]
+	switch {
+	case existing == nil && rev != "":
+		return "", "conflict"
+	case existing != nil && !(existing.deleted && rev == "") && existing.rev != rev:
+		return "", "conflict"
+	}
+	gen := 1
+	if existing != nil {
+		gen, _ = strconv.Atoi(strings.SplitN(existing.rev, "-", 2)[0])
+		gen++
+	}
+	deleted, _ := body["_deleted"].(bool)
+	for name := range body {
+		if strings.HasPrefix(name, "_") {
+			delete(body, name)
+		}
+	}
+	data, _ := json.Marshal(body)
+	s.seq++
+	doc := &couchDoc{rev: fmt.Sprintf("%d-%x", gen, md5.Sum(data)), seq: s.seq, deleted: deleted, body: body}
+	s.docs[id] = doc
+	return doc.rev, ""
+}
+
+func (s *couchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch path.Base(r.URL.Path) {
+	case "_changes":
+		since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		type change struct {
+			Seq     string              `json:"seq"`
+			ID      string              `json:"id"`
+			Deleted bool                `json:"deleted,omitempty"`
+			Changes []map[string]string `json:"changes"`
+			Doc     interface{}         `json:"doc"`
+		}
+		results := []change{}
+		for seq := since + 1; seq <= s.seq && (limit == 0 || len(results) < limit); seq++ {
+			for id, doc := range s.docs {
+				if doc.seq != seq {
+					continue
+				}
+				body := map[string]interface{}{"_id": id, "_rev": doc.rev}
+				if doc.deleted {
+					body["_deleted"] = true
+				} else {
+					for k, v := range doc.body {
+						body[k] = v
+					}
+				}
+				results = append(results, change{
+					Seq:     strconv.Itoa(seq),
+					ID:      id,
+					Deleted: doc.deleted,
+					Changes: []map[string]string{{"rev": doc.rev}},
+					Doc:     body,
+				})
+			}
+		}
+		lastSeq := strconv.Itoa(since)
+		if len(results) > 0 {
+			lastSeq = results[len(results)-1].Seq
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": results, "last_seq": lastSeq})
+	case "_bulk_docs":
+		var req struct {
+			Docs []map[string]interface{} `json:"docs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "bad_request", "reason": err.Error()})
+			return
+		}
+		var results []map[string]interface{}
+		for _, doc := range req.Docs {
+			id := doc["_id"]
+			if rev, e := s.put(doc); e != "" {
+				results = append(results, map[string]interface{}{"id": id, "error": e})
+			} else {
+				results = append(results, map[string]interface{}{"id": id, "ok": true, "rev": rev})
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(results)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "not_found"})
+	}
+}
+
+func newReplicator(t *testing.T, srv http.Handler) (*Replicator, func()) {
+	log, done := synctest.NewLog(t)
+	r := &Replicator{
+		Log:        log,
+		URL:        "http://couch.example/todos",
+		Table:      "todos",
+		HTTPClient: synctest.Client(srv),
+	}
+	return r, done
+}
+
+func TestReplicate(t *testing.T) {
+	srv := newCouchServer()
+	ctx := context.Background()
+	a, closeA := newReplicator(t, srv)
+	defer closeA()
+	b, closeB := newReplicator(t, srv)
+	defer closeB()
+
+	synctest.Exec(t, a.Log.DB, "INSERT INTO todos (id, title) VALUES (1, 'one'), (2, 'two')")
+	if err := a.Replicate(ctx); err != nil {
+		t.Fatalf("Error replicating a: %s", err)
+	}
+	doc := srv.docs["1"]
+	if doc == nil || !strings.HasPrefix(doc.rev, "1-") || !reflect.DeepEqual(doc.body, map[string]interface{}{"title": "one", "done": 0.0}) {
+		t.Fatalf("Unexpected document: %+v", doc)
+	}
+	if rev, err := a.Rev("1"); err != nil || rev != doc.rev {
+		t.Errorf("Expected rev %s, got %s, %v", doc.rev, rev, err)
+	}
+
+	if n, err := b.Pull(ctx); err != nil || n != 2 {
+		t.Fatalf("Expected to pull 2 documents, got %d, %v", n, err)
+	}
+	synctest.Exec(t, b.Log.DB, "UPDATE todos SET title = 'uno' WHERE id = 1")
+	synctest.Exec(t, b.Log.DB, "DELETE FROM todos WHERE id = 2")
+	if err := b.Replicate(ctx); err != nil {
+		t.Fatalf("Error replicating b: %s", err)
+	}
+	if !srv.docs["2"].deleted || !strings.HasPrefix(srv.docs["1"].rev, "2-") {
+		t.Fatalf("Unexpected server state: %+v %+v", srv.docs["1"], srv.docs["2"])
+	}
+	if err := a.Replicate(ctx); err != nil {
+		t.Fatalf("Error replicating a: %s", err)
+	}
+	expected := map[int64]string{1: "uno"}
+	for _, r := range []*Replicator{a, b} {
+		if got := synctest.Todos(t, r.Log.DB); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+		if pending, _ := r.Log.Pending(0); len(pending) != 0 {
+			t.Errorf("Unexpected pending changes: %+v", pending)
+		}
+	}
+}
+
+func TestFirstPull(t *testing.T) {
+	r, done := newReplicator(t, newCouchServer())
+	defer done()
+	if rev, err := r.Rev("1"); err != nil || rev != "" {
+		t.Errorf("Expected no rev, got %q, %v", rev, err)
+	}
+	if n, err := r.Pull(context.Background()); err != nil || n != 0 {
+		t.Fatalf("Expected to pull 0 documents, got %d, %v", n, err)
+	}
+}
+
+func TestPullSkipsNonIntegerIDs(t *testing.T) {
+	srv := newCouchServer()
+	ctx := context.Background()
+	r, done := newReplicator(t, srv)
+	defer done()
+
+	srv.put(map[string]interface{}{"_id": "6e1d9b3c2f0a4e57a1c0b4d2f3e5a6b7", "title": "uuid"})
+	srv.put(map[string]interface{}{"_id": "01", "title": "padded"})
+	srv.put(map[string]interface{}{"_id": "5", "title": "five"})
+	n, err := r.Pull(ctx)
+	skipped, ok := err.(*SkippedError)
+	if !ok || n != 1 {
+		t.Fatalf("Expected to pull 1 document and skip the others, got %d, %v", n, err)
+	}
+	if expected := []string{"6e1d9b3c2f0a4e57a1c0b4d2f3e5a6b7", "01"}; !reflect.DeepEqual(skipped.IDs, expected) {
+		t.Errorf("Expected %v to be skipped, got %v", expected, skipped.IDs)
+	}
+	if expected, got := map[int64]string{5: "five"}, synctest.Todos(t, r.Log.DB); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if n, err := r.Pull(ctx); err != nil || n != 0 {
+		t.Errorf("Expected the skipped documents not to be pulled again, got %d, %v", n, err)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	for _, localWins := range []bool{false, true} {
+		t.Run(fmt.Sprintf("LocalWins=%v", localWins), func(t *testing.T) {
+			srv := newCouchServer()
+			ctx := context.Background()
+			r, done := newReplicator(t, srv)
+			defer done()
+			r.LocalWins = localWins
+
+			synctest.Exec(t, r.Log.DB, "INSERT INTO todos (id, title) VALUES (1, 'one')")
+			if err := r.Replicate(ctx); err != nil {
+				t.Fatalf("Error replicating: %s", err)
+			}
+			// Edit the document remotely and the row locally.
+			srv.mu.Lock()
+			srv.put(map[string]interface{}{"_id": "1", "_rev": srv.docs["1"].rev, "title": "remote", "done": 1})
+			srv.mu.Unlock()
+			synctest.Exec(t, r.Log.DB, "UPDATE todos SET title = 'local' WHERE id = 1")
+
+			_, err := r.Push(ctx)
+			if e, ok := err.(*ConflictError); !ok || !reflect.DeepEqual(e.IDs, []string{"1"}) {
+				t.Fatalf("Expected conflict, got %v", err)
+			}
+			if err := r.Replicate(ctx); err != nil {
+				t.Fatalf("Error replicating: %s", err)
+			}
+			expected := "remote"
+			if localWins {
+				expected = "local"
+			}
+			if got := synctest.Todos(t, r.Log.DB)[1]; got != expected {
+				t.Errorf("Expected local title %q, got %q", expected, got)
+			}
+			if got := srv.docs["1"].body["title"]; got != expected {
+				t.Errorf("Expected remote title %q, got %q", expected, got)
+			}
+		})
+	}
+}
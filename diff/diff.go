@@ -0,0 +1,563 @@
+// Package diff compares two SQLite databases, such as two databases opened
+// with the sqljs driver, and produces an SQL script which transforms the first
+// into the second, similar to the sqldiff utility.
+//
+// Rows are matched by primary key, or by rowid for tables without an explicit
+// primary key. Tables whose definitions differ are dropped and recreated with
+// the contents of the second database. Rows of virtual tables are not
+// compared, and the shadow tables in which FTS and R*Tree virtual tables
+// store their data are left out.
+//
+// To compare bindings.Database instances, wrap them with sqljs.OpenDB().
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/flimzy/go-sql.js/schema"
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// Action is the kind of a change.
+type Action int
+
+const (
+	// Added means the object or row exists only in the second database.
+	Added Action = iota
+	// Removed means the object or row exists only in the first database.
+	Removed
+	// Changed means the object or row exists in both databases, with
+	// different definitions or values.
+	Changed
+)
+
+func (a Action) String() string {
+	switch a {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	}
+	return "changed"
+}
+
+// SchemaChange is a difference between the schema objects of two databases.
+type SchemaChange struct {
+	Action Action
+	// Type is the object type: "table", "index", "view" or "trigger".
+	Type string
+	Name string
+	// Table is the table an index or trigger belongs to.
+	Table string
+	// OldSQL and NewSQL are the definitions of the object in the first and
+	// second databases.
+	OldSQL, NewSQL string
+}
+
+// RowChange is a difference between the rows of a table. Every row of a
+// table which is added or recreated is reported as Added.
+type RowChange struct {
+	Action Action
+	Table  string
+	// KeyColumns are the names of the columns which identify the row. For
+	// tables without a primary key, it is "rowid".
+	KeyColumns []string
+	Key        []interface{}
+	Columns    []string
+	// Old and New are the values of the row in the first and second
+	// databases, in the order of Columns. Old is nil for added rows, and New
+	// is nil for removed rows.
+	Old, New []interface{}
+}
+
+// Result is the difference between two databases.
+type Result struct {
+	Schema []SchemaChange
+	Rows   []RowChange
+	// rebuild holds unchanged indexes and triggers which must be created
+	// again because their table is recreated.
+	rebuild []object
+}
+
+// Empty returns true if the databases are identical.
+func (r *Result) Empty() bool {
+	return len(r.Schema) == 0 && len(r.Rows) == 0
+}
+
+// Options configure a comparison.
+type Options struct {
+	// Tables limits the comparison to the named tables, and the indexes and
+	// triggers defined on them. If empty, all tables, indexes, views and
+	// triggers are compared.
+	Tables []string
+	// SchemaOnly skips the comparison of rows.
+	SchemaOnly bool
+}
+
+type object struct {
+	typ, name, table, sql string
+}
+
+func objects(db *sql.DB, opts Options) (map[string]object, []string, error) {
+	rows, err := db.Query("SELECT type, name, tbl_name, sql FROM sqlite_master " +
+		"WHERE sql IS NOT NULL AND substr(name, 1, 7) <> 'sqlite_' ORDER BY rowid")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	tables := make(map[string]bool, len(opts.Tables))
+	for _, t := range opts.Tables {
+		tables[t] = true
+	}
+	objs := make(map[string]object)
+	var order []string
+	for rows.Next() {
+		var o object
+		if err := rows.Scan(&o.typ, &o.name, &o.table, &o.sql); err != nil {
+			return nil, nil, err
+		}
+		if len(opts.Tables) > 0 && (o.typ == "view" || !tables[o.table]) {
+			continue
+		}
+		key := o.typ + " " + o.name
+		objs[key] = o
+		order = append(order, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	// Shadow tables are created and dropped along with their virtual table,
+	// so they are left out.
+	var virtual []string
+	for _, key := range order {
+		if o := objs[key]; o.typ == "table" && script.IsVirtualTable(o.sql) {
+			virtual = append(virtual, o.name)
+		}
+	}
+	kept := order[:0]
+	for _, key := range order {
+		if o := objs[key]; o.typ == "table" && isShadowTable(o.name, virtual) {
+			delete(objs, key)
+			continue
+		}
+		kept = append(kept, key)
+	}
+	return objs, kept, nil
+}
+
+func isShadowTable(table string, virtual []string) bool {
+	for _, vtable := range virtual {
+		if script.IsShadowTable(table, vtable) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare compares database a with database b.
+func Compare(a, b *sql.DB, opts Options) (*Result, error) {
+	objsA, orderA, err := objects(a, opts)
+	if err != nil {
+		return nil, err
+	}
+	objsB, orderB, err := objects(b, opts)
+	if err != nil {
+		return nil, err
+	}
+	r := &Result{}
+	for _, key := range orderA {
+		if _, ok := objsB[key]; !ok {
+			o := objsA[key]
+			r.Schema = append(r.Schema, SchemaChange{Action: Removed, Type: o.typ, Name: o.name, Table: o.table, OldSQL: o.sql})
+		}
+	}
+	recreated := make(map[string]bool)
+	for _, key := range orderB {
+		o := objsB[key]
+		old, ok := objsA[key]
+		switch {
+		case !ok:
+			r.Schema = append(r.Schema, SchemaChange{Action: Added, Type: o.typ, Name: o.name, Table: o.table, NewSQL: o.sql})
+		case old.sql != o.sql:
+			r.Schema = append(r.Schema, SchemaChange{Action: Changed, Type: o.typ, Name: o.name, Table: o.table, OldSQL: old.sql, NewSQL: o.sql})
+		default:
+			continue
+		}
+		if o.typ == "table" {
+			recreated[o.name] = true
+		}
+	}
+	for _, key := range orderB {
+		o := objsB[key]
+		old, ok := objsA[key]
+		switch {
+		case o.typ == "table" || o.typ == "view":
+		case ok && old.sql == o.sql && recreated[o.table]:
+			r.rebuild = append(r.rebuild, o)
+		}
+	}
+	if opts.SchemaOnly {
+		return r, nil
+	}
+	for _, key := range orderB {
+		o := objsB[key]
+		if o.typ != "table" || script.IsVirtualTable(o.sql) {
+			continue
+		}
+		var err error
+		if recreated[o.name] {
+			err = r.compareRows(nil, b, o.name)
+		} else {
+			err = r.compareRows(a, b, o.name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// keyColumns returns the primary key columns of the table, or rowid, and the
+// names of all columns.
+func keyColumns(db *sql.DB, table string) (keys, names []string, err error) {
+	cols, err := schema.Columns(db, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	names = make([]string, len(cols))
+	var pk []schema.Column
+	for i, c := range cols {
+		names[i] = c.Name
+		if c.PrimaryKey > 0 {
+			pk = append(pk, c)
+		}
+	}
+	if len(pk) == 0 {
+		return []string{"rowid"}, names, nil
+	}
+	sort.Slice(pk, func(i, j int) bool { return pk[i].PrimaryKey < pk[j].PrimaryKey })
+	keys = make([]string, len(pk))
+	for i, c := range pk {
+		keys[i] = c.Name
+	}
+	return keys, names, nil
+}
+
+// compareRows compares the rows of a table. If a is nil, every row in b is
+// reported as added.
+func (r *Result) compareRows(a, b *sql.DB, table string) error {
+	keys, cols, err := keyColumns(b, table)
+	if err != nil {
+		return err
+	}
+	rowsB, err := queryTable(b, table, keys, cols)
+	if err != nil {
+		return err
+	}
+	defer rowsB.close()
+	rowsA := &tableRows{}
+	if a != nil {
+		if rowsA, err = queryTable(a, table, keys, cols); err != nil {
+			return err
+		}
+		defer rowsA.close()
+	}
+	var deletes, updates, inserts []RowChange
+	change := func(action Action) RowChange {
+		return RowChange{Action: action, Table: table, KeyColumns: keys, Columns: cols}
+	}
+	for rowsA.ok || rowsB.ok {
+		cmp := 0
+		switch {
+		case !rowsA.ok:
+			cmp = 1
+		case !rowsB.ok:
+			cmp = -1
+		default:
+			cmp = compareKeys(rowsA.key, rowsB.key)
+		}
+		switch {
+		case cmp < 0:
+			c := change(Removed)
+			c.Key, c.Old = rowsA.key, rowsA.vals
+			deletes = append(deletes, c)
+			rowsA.next()
+		case cmp > 0:
+			c := change(Added)
+			c.Key, c.New = rowsB.key, rowsB.vals
+			inserts = append(inserts, c)
+			rowsB.next()
+		default:
+			if !equalValues(rowsA.vals, rowsB.vals) {
+				c := change(Changed)
+				c.Key, c.Old, c.New = rowsB.key, rowsA.vals, rowsB.vals
+				updates = append(updates, c)
+			}
+			rowsA.next()
+			rowsB.next()
+		}
+	}
+	if rowsA.err != nil {
+		return rowsA.err
+	}
+	if rowsB.err != nil {
+		return rowsB.err
+	}
+	r.Rows = append(r.Rows, deletes...)
+	r.Rows = append(r.Rows, updates...)
+	r.Rows = append(r.Rows, inserts...)
+	return nil
+}
+
+// tableRows iterates over the rows of a table, ordered by key.
+type tableRows struct {
+	rows *sql.Rows
+	nkey int
+	key  []interface{}
+	vals []interface{}
+	ok   bool
+	err  error
+}
+
+func queryTable(db *sql.DB, table string, keys, cols []string) (*tableRows, error) {
+	selected := make([]string, 0, len(keys)+len(cols))
+	order := make([]string, len(keys))
+	for i, k := range keys {
+		selected = append(selected, script.QuoteIdent(k))
+		// Collate as binary so the order matches compareValues.
+		order[i] = script.QuoteIdent(k) + " COLLATE BINARY"
+	}
+	for _, c := range cols {
+		selected = append(selected, script.QuoteIdent(c))
+	}
+	rows, err := db.Query("SELECT " + strings.Join(selected, ", ") + " FROM " + script.QuoteIdent(table) +
+		" ORDER BY " + strings.Join(order, ", "))
+	if err != nil {
+		return nil, err
+	}
+	t := &tableRows{rows: rows, nkey: len(keys)}
+	t.next()
+	return t, nil
+}
+
+func (t *tableRows) next() {
+	if t.ok = t.rows.Next(); !t.ok {
+		t.err = t.rows.Err()
+		return
+	}
+	cols, _ := t.rows.Columns()
+	values := make([]interface{}, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if t.err = t.rows.Scan(dest...); t.err != nil {
+		t.ok = false
+		return
+	}
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			values[i] = append([]byte{}, b...)
+		}
+	}
+	t.key, t.vals = values[:t.nkey], values[t.nkey:]
+}
+
+func (t *tableRows) close() {
+	if t.rows != nil {
+		t.rows.Close()
+	}
+}
+
+// storageClass orders values the way SQLite does: NULL, then numbers, then
+// text, then BLOBs.
+func storageClass(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case int64, float64, bool:
+		return 1
+	case string:
+		return 2
+	}
+	return 3
+}
+
+func number(v interface{}) float64 {
+	switch t := v.(type) {
+	case int64:
+		return float64(t)
+	case float64:
+		return t
+	case bool:
+		if t {
+			return 1
+		}
+	}
+	return 0
+}
+
+func compareValues(a, b interface{}) int {
+	ca, cb := storageClass(a), storageClass(b)
+	if ca != cb {
+		return ca - cb
+	}
+	switch ca {
+	case 1:
+		if ia, ok := a.(int64); ok {
+			if ib, ok := b.(int64); ok {
+				switch {
+				case ia < ib:
+					return -1
+				case ia > ib:
+					return 1
+				}
+				return 0
+			}
+		}
+		na, nb := number(a), number(b)
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+	case 2:
+		return strings.Compare(a.(string), b.(string))
+	case 3:
+		return bytes.Compare(blob(a), blob(b))
+	}
+	return 0
+}
+
+func blob(v interface{}) []byte {
+	if b, ok := v.([]byte); ok {
+		return b
+	}
+	return []byte(fmt.Sprint(v))
+}
+
+func compareKeys(a, b []interface{}) int {
+	for i := range a {
+		if c := compareValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// equalValues reports whether two rows hold the same values with the same
+// storage classes.
+func equalValues(a, b []interface{}) bool {
+	for i := range a {
+		if !equalValue(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalValue(a, b interface{}) bool {
+	switch t := a.(type) {
+	case []byte:
+		u, ok := b.([]byte)
+		return ok && bytes.Equal(t, u)
+	case float64:
+		u, ok := b.(float64)
+		return ok && (t == u || math.IsNaN(t) && math.IsNaN(u))
+	}
+	return a == b
+}
+
+// WriteSQL writes an SQL script which transforms the first database into
+// the second. Foreign key enforcement and triggers are not disabled by the
+// script; callers applying it to databases which use them may need to do so.
+func (r *Result) WriteSQL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	// Drop indexes, triggers and views first, then tables, so no object is
+	// dropped after the table it belongs to.
+	for _, typ := range []string{"trigger", "view", "index", "table"} {
+		for _, c := range r.Schema {
+			if c.Type == typ && c.Action != Added {
+				fmt.Fprintf(bw, "DROP %s IF EXISTS %s;\n", strings.ToUpper(typ), script.QuoteIdent(c.Name))
+			}
+		}
+	}
+	for _, c := range r.Schema {
+		if c.Type == "table" && c.Action != Removed {
+			fmt.Fprintf(bw, "%s;\n", c.NewSQL)
+		}
+	}
+	for _, c := range r.Rows {
+		writeRowChange(bw, c)
+	}
+	for _, c := range r.Schema {
+		if c.Type != "table" && c.Action != Removed {
+			fmt.Fprintf(bw, "%s;\n", c.NewSQL)
+		}
+	}
+	for _, o := range r.rebuild {
+		fmt.Fprintf(bw, "%s;\n", o.sql)
+	}
+	return bw.Flush()
+}
+
+func writeRowChange(w io.Writer, c RowChange) {
+	table := script.QuoteIdent(c.Table)
+	switch c.Action {
+	case Added:
+		cols := make([]string, len(c.Columns))
+		vals := make([]string, len(c.New))
+		for i, name := range c.Columns {
+			cols[i] = script.QuoteIdent(name)
+			vals[i] = script.Literal(c.New[i])
+		}
+		if len(c.KeyColumns) == 1 && c.KeyColumns[0] == "rowid" {
+			cols = append([]string{"rowid"}, cols...)
+			vals = append([]string{script.Literal(c.Key[0])}, vals...)
+		}
+		fmt.Fprintf(w, "INSERT INTO %s (%s) VALUES (%s);\n", table, strings.Join(cols, ", "), strings.Join(vals, ", "))
+	case Removed:
+		fmt.Fprintf(w, "DELETE FROM %s WHERE %s;\n", table, whereKey(c))
+	case Changed:
+		var set []string
+		for i, name := range c.Columns {
+			if !equalValue(c.Old[i], c.New[i]) {
+				set = append(set, script.QuoteIdent(name)+" = "+script.Literal(c.New[i]))
+			}
+		}
+		fmt.Fprintf(w, "UPDATE %s SET %s WHERE %s;\n", table, strings.Join(set, ", "), whereKey(c))
+	}
+}
+
+func whereKey(c RowChange) string {
+	terms := make([]string, len(c.KeyColumns))
+	for i, name := range c.KeyColumns {
+		if name != "rowid" {
+			name = script.QuoteIdent(name)
+		}
+		if c.Key[i] == nil {
+			terms[i] = name + " IS NULL"
+		} else {
+			terms[i] = name + " = " + script.Literal(c.Key[i])
+		}
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// Script compares database a with database b, and writes an SQL script which
+// transforms a into b.
+func Script(a, b *sql.DB, w io.Writer, opts Options) error {
+	r, err := Compare(a, b, opts)
+	if err != nil {
+		return err
+	}
+	return r.WriteSQL(w)
+}
@@ -0,0 +1,160 @@
+// +build js
+
+package diff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/flimzy/go-sql.js"
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+const schemaA = `
+CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, age INTEGER);
+INSERT INTO people VALUES (1, 'Alice', 30), (2, 'Bob', 40), (3, 'Carol', 50);
+CREATE TABLE tags (tag TEXT);
+INSERT INTO tags VALUES ('a'), ('b');
+CREATE TABLE old (x);
+CREATE INDEX people_name ON people (name);
+`
+
+const schemaB = `
+CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, age INTEGER);
+INSERT INTO people VALUES (1, 'Alice', 31), (3, 'Carol', 50), (4, 'Dave', NULL);
+CREATE TABLE tags (tag TEXT, color TEXT);
+INSERT INTO tags VALUES ('a', 'red');
+CREATE TABLE files (name TEXT PRIMARY KEY, data BLOB) WITHOUT ROWID;
+INSERT INTO files VALUES ('x', x'00ff');
+CREATE INDEX people_name ON people (name, age);
+CREATE VIEW adults AS SELECT name FROM people WHERE age >= 18;
+CREATE TABLE sqlitex (x);
+`
+
+func open(t *testing.T, script string) (*bindings.Database, func()) {
+	bdb := bindings.New()
+	if err := bdb.Run(script); err != nil {
+		t.Fatalf("Error creating database: %s", err)
+	}
+	return bdb, func() { bdb.Close() }
+}
+
+func TestCompare(t *testing.T) {
+	bdbA, closeA := open(t, schemaA)
+	defer closeA()
+	bdbB, closeB := open(t, schemaB)
+	defer closeB()
+	a, b := sqljs.OpenDB(bdbA), sqljs.OpenDB(bdbB)
+	defer a.Close()
+	defer b.Close()
+
+	r, err := Compare(a, b, Options{})
+	if err != nil {
+		t.Fatalf("Error comparing: %s", err)
+	}
+	schemaChanges := map[string]Action{}
+	for _, c := range r.Schema {
+		schemaChanges[c.Type+" "+c.Name] = c.Action
+	}
+	expectedSchema := map[string]Action{
+		"table old":         Removed,
+		"table tags":        Changed,
+		"table files":       Added,
+		"index people_name": Changed,
+		"view adults":       Added,
+		"table sqlitex":     Added,
+	}
+	if len(schemaChanges) != len(expectedSchema) {
+		t.Fatalf("Unexpected schema changes: %+v", r.Schema)
+	}
+	for k, v := range expectedSchema {
+		if schemaChanges[k] != v {
+			t.Errorf("Expected %s to be %s, got %+v", k, v, r.Schema)
+		}
+	}
+
+	var people []RowChange
+	for _, c := range r.Rows {
+		if c.Table == "people" {
+			people = append(people, c)
+		}
+	}
+	if len(people) != 3 || people[0].Action != Removed || people[1].Action != Changed || people[2].Action != Added {
+		t.Fatalf("Unexpected row changes: %+v", people)
+	}
+	if people[1].Key[0] != int64(1) || people[1].New[2] != int64(31) {
+		t.Errorf("Unexpected update: %+v", people[1])
+	}
+
+	buf := new(bytes.Buffer)
+	if err := r.WriteSQL(buf); err != nil {
+		t.Fatalf("Error writing script: %s", err)
+	}
+	if _, err := bdbA.Exec(buf.String()); err != nil {
+		t.Fatalf("Error applying script: %s\n%s", err, buf)
+	}
+	r, err = Compare(a, b, Options{})
+	if err != nil {
+		t.Fatalf("Error comparing: %s", err)
+	}
+	if !r.Empty() {
+		t.Fatalf("Expected no differences after applying script, got %+v", r)
+	}
+}
+
+func TestCompareTables(t *testing.T) {
+	bdbA, closeA := open(t, schemaA)
+	defer closeA()
+	bdbB, closeB := open(t, schemaB)
+	defer closeB()
+	a, b := sqljs.OpenDB(bdbA), sqljs.OpenDB(bdbB)
+	defer a.Close()
+	defer b.Close()
+
+	buf := new(bytes.Buffer)
+	if err := Script(a, b, buf, Options{Tables: []string{"people"}, SchemaOnly: true}); err != nil {
+		t.Fatalf("Error writing script: %s", err)
+	}
+	expected := `DROP INDEX IF EXISTS "people_name";
+CREATE INDEX people_name ON people (name, age);
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected script:\n%s", buf)
+	}
+}
+
+func TestCompareVirtualTable(t *testing.T) {
+	bdbA, closeA := open(t, "CREATE TABLE docs (body TEXT);")
+	defer closeA()
+	bdbB, closeB := open(t, "CREATE TABLE docs (body TEXT);")
+	defer closeB()
+	if err := bdbB.Run("CREATE VIRTUAL TABLE docs_fts USING fts5(body)"); err != nil {
+		if err := bdbB.Run("CREATE VIRTUAL TABLE docs_fts USING fts4(body)"); err != nil {
+			t.Skipf("FTS not available: %s", err)
+		}
+	}
+	a, b := sqljs.OpenDB(bdbA), sqljs.OpenDB(bdbB)
+	defer a.Close()
+	defer b.Close()
+
+	r, err := Compare(a, b, Options{})
+	if err != nil {
+		t.Fatalf("Error comparing: %s", err)
+	}
+	if len(r.Schema) != 1 || r.Schema[0].Name != "docs_fts" || r.Schema[0].Action != Added {
+		t.Fatalf("Unexpected schema changes: %+v", r.Schema)
+	}
+	buf := new(bytes.Buffer)
+	if err := r.WriteSQL(buf); err != nil {
+		t.Fatalf("Error writing script: %s", err)
+	}
+	if _, err := bdbA.Exec(buf.String()); err != nil {
+		t.Fatalf("Error applying script: %s\n%s", err, buf)
+	}
+	if r, err = Compare(a, b, Options{}); err != nil {
+		t.Fatalf("Error comparing: %s", err)
+	}
+	if !r.Empty() {
+		t.Fatalf("Expected no differences after applying script, got %+v", r)
+	}
+}
@@ -0,0 +1,77 @@
+package sqljs
+
+import (
+	"database/sql/driver"
+	"io"
+
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+// Driver struct. To load an existing database, you must register a new instance
+// of this driver, with an io.Reader pointing to the SQLite3 database file.  See
+// Open() for an example.
+//
+// Every field applies to every Backend, except ReportLeaks, Journal and
+// ConnectHook, which apply only to connections opened by SQLJSBackend, and
+// are ignored by other backends, such as NativeBackend.
+type SQLJSDriver struct {
+	// Backend opens the driver's databases. If nil, SQLJSBackend is used in
+	// GopherJS and WebAssembly builds, and NativeBackend in other builds.
+	Backend Backend
+	// ReadOnly, when true, causes Prepare() to reject any statement which
+	// would modify the database. Backends which cannot tell whether a
+	// statement is read-only reject every statement. With builds of SQL.js
+	// which do not export sqlite3_stmt_readonly, the statement's leading
+	// keyword is checked, as described for bindings.Statement.IsReadOnly.
+	ReadOnly bool
+	// Trace, if set, is called with the expanded SQL text (with bound
+	// parameters substituted) of every statement executed or queried, or
+	// with the unexpanded text if the backend cannot expand it.
+	Trace func(query string)
+	// StatementCacheSize is the number of idle prepared statements cached
+	// per connection, keyed by their SQL text. If 0,
+	// DefaultStatementCacheSize is used. A negative value disables the cache.
+	StatementCacheSize int
+	// ReportLeaks, if set, enables statement lifecycle debugging. The
+	// creation stack of every prepared statement is recorded, and when a
+	// connection is closed, ReportLeaks is called with the statements which
+	// were never closed.
+	ReportLeaks func(leaks []LiveStatement)
+	// Journal, if set, receives a journal of every mutating statement
+	// executed on the driver's connections, which can be replayed with
+	// bindings.Replay(). See bindings.Database.SetJournal() for the format.
+	Journal io.Writer
+	// ConnectHook, if set, is called with the database of every new
+	// connection, for example to register SQL functions. If it returns an
+	// error, the database is closed and Open fails.
+	ConnectHook func(db *bindings.Database) error
+}
+
+// LiveStatement describes a prepared statement which has not been freed.
+type LiveStatement = bindings.LiveStatement
+
+// Open will a new database instance. By default, it will create a new database
+// in memory. To open an existing database, you must first register a new
+// instance as the driver. The DSN string is always ignored.
+//
+// INTEGER values are returned as exact int64 values, even beyond the 2^53
+// range of JavaScript numbers.
+//
+// Example:
+//
+//    driver := &sqljs.SQLJSDriver{}
+//    sql.Register("sqljs-reader", driver)
+//    file, _ := os.Open("/path/to/database.db")
+//    driver.Reader, _ = file
+//    db := sql.Open("sqljs-reader","")
+func (d *SQLJSDriver) Open(dsn string) (driver.Conn, error) {
+	db, err := d.openBackend(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.setup(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d.newConn(db), nil
+}
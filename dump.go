@@ -0,0 +1,184 @@
+package sqljs
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// DumpOptions configure Dump.
+type DumpOptions struct {
+	// Tables limits the dump to the named tables and views, and the indexes
+	// and triggers defined on them. If empty, the whole database is dumped.
+	Tables []string
+	// SchemaOnly omits the INSERT statements.
+	SchemaOnly bool
+	// DataOnly omits the CREATE statements.
+	DataOnly bool
+}
+
+// Dump writes the contents of the database to w as an SQL script, like the
+// sqlite3 shell's .dump command: CREATE statements for tables, followed by
+// INSERT statements for their rows, and then CREATE statements for indexes,
+// triggers and views, all wrapped in a single transaction. Unlike .dump, it
+// leaves out the shadow tables of FTS and R*Tree virtual tables, and inserts
+// their rows through the virtual table instead.
+//
+// Unlike Database.Export, the output is human-readable, and suitable for
+// diffing. It can be restored with ImportScript, or Database.Run.
+func Dump(db *sql.DB, w io.Writer, opts DumpOptions) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	objs, err := dumpObjects(tx, opts.Tables)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\n")
+	for _, obj := range objs {
+		if obj.typ != "table" {
+			continue
+		}
+		if obj.name == "sqlite_sequence" {
+			if !opts.SchemaOnly {
+				bw.WriteString("DELETE FROM sqlite_sequence;\n")
+			}
+		} else if strings.HasPrefix(obj.name, "sqlite_") {
+			continue
+		} else if !opts.DataOnly {
+			fmt.Fprintf(bw, "%s;\n", obj.sql)
+		}
+		if opts.SchemaOnly {
+			continue
+		}
+		if err := dumpRows(tx, bw, obj.name, script.IsVirtualTable(obj.sql)); err != nil {
+			return err
+		}
+	}
+	if !opts.DataOnly {
+		for _, obj := range objs {
+			if obj.typ != "table" && obj.sql != "" {
+				fmt.Fprintf(bw, "%s;\n", obj.sql)
+			}
+		}
+	}
+	bw.WriteString("COMMIT;\n")
+	return bw.Flush()
+}
+
+type dumpObject struct {
+	typ, name, sql string
+}
+
+// dumpObjects returns the objects to dump, in the order in which they were
+// created. The shadow tables of virtual tables are left out, as they are
+// created again by CREATE VIRTUAL TABLE.
+func dumpObjects(tx *sql.Tx, tables []string) ([]dumpObject, error) {
+	rows, err := tx.Query("SELECT type, name, tbl_name, COALESCE(sql, '') FROM sqlite_master " +
+		"WHERE sql IS NOT NULL OR name = 'sqlite_sequence' ORDER BY rowid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var objs []dumpObject
+	for rows.Next() {
+		var obj dumpObject
+		var table string
+		if err := rows.Scan(&obj.typ, &obj.name, &table, &obj.sql); err != nil {
+			return nil, err
+		}
+		if len(tables) > 0 && !containsString(tables, table) {
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var virtual []string
+	for _, obj := range objs {
+		if obj.typ == "table" && script.IsVirtualTable(obj.sql) {
+			virtual = append(virtual, obj.name)
+		}
+	}
+	kept := objs[:0]
+	for _, obj := range objs {
+		if obj.typ != "table" || !isShadowTable(obj.name, virtual) {
+			kept = append(kept, obj)
+		}
+	}
+	return kept, nil
+}
+
+func isShadowTable(table string, virtual []string) bool {
+	for _, vtable := range virtual {
+		if script.IsShadowTable(table, vtable) {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpRows writes INSERT statements for the rows of table. The rows of a
+// virtual table are written with their rowids, and inserted through the
+// virtual table, which rebuilds the contents of its shadow tables.
+func dumpRows(tx *sql.Tx, w *bufio.Writer, table string, virtual bool) error {
+	name := script.QuoteIdent(table)
+	query := "SELECT * FROM " + name
+	if virtual {
+		query = "SELECT rowid, * FROM " + name
+	}
+	rows, err := tx.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	insert := "INSERT INTO " + name + " VALUES("
+	if virtual {
+		quoted := make([]string, len(cols))
+		for i, col := range cols {
+			quoted[i] = script.QuoteIdent(col)
+		}
+		insert = "INSERT INTO " + name + "(" + strings.Join(quoted, ",") + ") VALUES("
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		w.WriteString(insert)
+		for i, v := range values {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(script.Literal(v))
+		}
+		w.WriteString(");\n")
+	}
+	return rows.Err()
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
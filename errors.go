@@ -0,0 +1,51 @@
+package sqljs
+
+import (
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+// Error is an error reported by SQLite, carrying its result codes. Errors
+// returned by the driver can be inspected with errors.As(), or compared
+// against the sentinel values below with errors.Is():
+//
+//	if errors.Is(err, sqljs.ErrConstraintUnique) {
+//	    // handle duplicate
+//	}
+type Error = bindings.Error
+
+// Sentinel errors, for use with errors.Is(). ErrReadOnlyDatabase is
+// SQLITE_READONLY, reported by SQLite itself; it is unrelated to ErrReadOnly,
+// which is returned by the driver's ReadOnly mode.
+//
+// See https://www.sqlite.org/rescode.html
+var (
+	ErrError            = bindings.ErrError
+	ErrInternal         = bindings.ErrInternal
+	ErrPerm             = bindings.ErrPerm
+	ErrAbort            = bindings.ErrAbort
+	ErrBusy             = bindings.ErrBusy
+	ErrLocked           = bindings.ErrLocked
+	ErrNoMem            = bindings.ErrNoMem
+	ErrReadOnlyDatabase = bindings.ErrReadOnly
+	ErrInterrupt        = bindings.ErrInterrupt
+	ErrIOErr            = bindings.ErrIOErr
+	ErrCorrupt          = bindings.ErrCorrupt
+	ErrNotFound         = bindings.ErrNotFound
+	ErrFull             = bindings.ErrFull
+	ErrCantOpen         = bindings.ErrCantOpen
+	ErrProtocol         = bindings.ErrProtocol
+	ErrSchema           = bindings.ErrSchema
+	ErrTooBig           = bindings.ErrTooBig
+	ErrConstraint       = bindings.ErrConstraint
+	ErrMismatch         = bindings.ErrMismatch
+	ErrMisuse           = bindings.ErrMisuse
+	ErrRange            = bindings.ErrRange
+	ErrNotADB           = bindings.ErrNotADB
+
+	ErrConstraintCheck      = bindings.ErrConstraintCheck
+	ErrConstraintForeignKey = bindings.ErrConstraintForeignKey
+	ErrConstraintNotNull    = bindings.ErrConstraintNotNull
+	ErrConstraintPrimaryKey = bindings.ErrConstraintPrimaryKey
+	ErrConstraintTrigger    = bindings.ErrConstraintTrigger
+	ErrConstraintUnique     = bindings.ErrConstraintUnique
+)
@@ -0,0 +1,280 @@
+// Package export streams query results to CSV, TSV, JSON or NDJSON.
+//
+// Results may be read from a *sql.Rows, or from a bindings.Statement, and are
+// written one row at a time, so arbitrarily large results may be exported.
+//
+//    rows, err := db.Query("SELECT * FROM people")
+//    ...
+//    n, err := export.Rows(w, rows, export.Options{Format: export.CSV})
+package export
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Format is the output format.
+type Format int
+
+const (
+	// CSV writes comma-separated values, with a header row.
+	CSV Format = iota
+	// TSV writes tab-separated values, with a header row.
+	TSV
+	// JSON writes a single array of objects, one per row, whose keys are
+	// written in column order.
+	JSON
+	// NDJSON writes one JSON object per row, separated by newlines.
+	NDJSON
+)
+
+// BlobEncoding determines how BLOB values are written.
+type BlobEncoding int
+
+const (
+	// Base64 encodes BLOBs with standard base64 encoding.
+	Base64 BlobEncoding = iota
+	// Hex encodes BLOBs as lower-case hexadecimal.
+	Hex
+)
+
+// Options configure an export.
+type Options struct {
+	Format Format
+	// Blobs determines how BLOB ([]byte) values are encoded.
+	Blobs BlobEncoding
+	// Null is the text written for NULL values in CSV and TSV output. In
+	// JSON output, NULL is always written as null.
+	Null string
+	// NoHeader omits the header row from CSV and TSV output.
+	NoHeader bool
+}
+
+// Source is a result set to be exported.
+type Source interface {
+	// Columns returns the names of the result columns.
+	Columns() ([]string, error)
+	// Next advances to the next row, returning false when there are no more
+	// rows or an error occurred.
+	Next() bool
+	// Values returns the values of the current row.
+	Values() ([]interface{}, error)
+	// Err returns the error, if any, which stopped iteration.
+	Err() error
+}
+
+type rowsSource struct {
+	*sql.Rows
+	n int
+}
+
+func (r *rowsSource) Values() ([]interface{}, error) {
+	if r.n == 0 {
+		cols, err := r.Columns()
+		if err != nil {
+			return nil, err
+		}
+		r.n = len(cols)
+	}
+	values := make([]interface{}, r.n)
+	ptrs := make([]interface{}, r.n)
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	return values, r.Scan(ptrs...)
+}
+
+// FromRows returns a Source which reads from rows.
+func FromRows(rows *sql.Rows) Source {
+	return &rowsSource{Rows: rows}
+}
+
+// Rows writes rows to w, and closes them. It returns the number of rows
+// written.
+func Rows(w io.Writer, rows *sql.Rows, opts Options) (int, error) {
+	defer rows.Close()
+	return Write(w, FromRows(rows), opts)
+}
+
+// Write writes the rows of src to w. It returns the number of rows written.
+func Write(w io.Writer, src Source, opts Options) (int, error) {
+	cols, err := src.Columns()
+	if err != nil {
+		return 0, err
+	}
+	var out rowWriter
+	switch opts.Format {
+	case CSV, TSV:
+		out = newCSVWriter(w, cols, opts)
+	case JSON, NDJSON:
+		out = newJSONWriter(w, cols, opts)
+	default:
+		return 0, fmt.Errorf("export: unknown format %d", opts.Format)
+	}
+	if err := out.begin(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for src.Next() {
+		values, err := src.Values()
+		if err != nil {
+			return n, err
+		}
+		if err := out.row(values); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := src.Err(); err != nil {
+		return n, err
+	}
+	return n, out.end()
+}
+
+type rowWriter interface {
+	begin() error
+	row(values []interface{}) error
+	end() error
+}
+
+func encodeBlob(b []byte, enc BlobEncoding) string {
+	if enc == Hex {
+		return hex.EncodeToString(b)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	cols   []string
+	opts   Options
+	fields []string
+}
+
+func newCSVWriter(w io.Writer, cols []string, opts Options) *csvWriter {
+	cw := csv.NewWriter(w)
+	if opts.Format == TSV {
+		cw.Comma = '\t'
+	}
+	return &csvWriter{w: cw, cols: cols, opts: opts, fields: make([]string, len(cols))}
+}
+
+func (c *csvWriter) begin() error {
+	if c.opts.NoHeader {
+		return nil
+	}
+	return c.w.Write(c.cols)
+}
+
+func (c *csvWriter) row(values []interface{}) error {
+	for i, v := range values {
+		c.fields[i] = c.text(v)
+	}
+	return c.w.Write(c.fields)
+}
+
+func (c *csvWriter) text(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return c.opts.Null
+	case []byte:
+		return encodeBlob(t, c.opts.Blobs)
+	case string:
+		return t
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+func (c *csvWriter) end() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonWriter struct {
+	w    *bufio.Writer
+	keys [][]byte
+	opts Options
+	rows int
+}
+
+func newJSONWriter(w io.Writer, cols []string, opts Options) *jsonWriter {
+	keys := make([][]byte, len(cols))
+	for i, col := range cols {
+		keys[i], _ = json.Marshal(col)
+	}
+	return &jsonWriter{w: bufio.NewWriter(w), keys: keys, opts: opts}
+}
+
+func (j *jsonWriter) begin() error {
+	if j.opts.Format == JSON {
+		_, err := j.w.WriteString("[")
+		return err
+	}
+	return nil
+}
+
+func (j *jsonWriter) row(values []interface{}) error {
+	if j.opts.Format == JSON && j.rows > 0 {
+		j.w.WriteString(",\n")
+	} else if j.opts.Format == JSON {
+		j.w.WriteString("\n")
+	}
+	j.rows++
+	j.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		j.w.Write(j.keys[i])
+		j.w.WriteByte(':')
+		b, err := json.Marshal(j.value(v))
+		if err != nil {
+			return err
+		}
+		j.w.Write(b)
+	}
+	j.w.WriteByte('}')
+	if j.opts.Format == NDJSON {
+		j.w.WriteByte('\n')
+	}
+	return nil
+}
+
+func (j *jsonWriter) value(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []byte:
+		return encodeBlob(t, j.opts.Blobs)
+	case float64:
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return nil
+		}
+	}
+	return v
+}
+
+func (j *jsonWriter) end() error {
+	if j.opts.Format == JSON {
+		if j.rows > 0 {
+			j.w.WriteString("\n")
+		}
+		j.w.WriteString("]\n")
+	}
+	return j.w.Flush()
+}
@@ -0,0 +1,105 @@
+// +build js
+
+package export
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+
+	_ "github.com/flimzy/go-sql.js"
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+const testData = `
+CREATE TABLE t (id INTEGER, name TEXT, score REAL, data BLOB);
+INSERT INTO t VALUES (1, 'Bob', 1.5, x'00ff10'), (2, 'Smith, "J"', NULL, NULL);
+`
+
+func TestRows(t *testing.T) {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(testData); err != nil {
+		t.Fatalf("Error creating test data: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{
+			name:     "csv",
+			opts:     Options{Format: CSV, Blobs: Hex, Null: "NULL"},
+			expected: "data,name,id,score\n00ff10,Bob,1,1.5\nNULL,\"Smith, \"\"J\"\"\",2,NULL\n",
+		},
+		{
+			name:     "tsv",
+			opts:     Options{Format: TSV, NoHeader: true},
+			expected: "AP8Q\tBob\t1\t1.5\n\t\"Smith, \"\"J\"\"\"\t2\t\n",
+		},
+		{
+			name:     "json",
+			opts:     Options{Format: JSON},
+			expected: "[\n{\"data\":\"AP8Q\",\"name\":\"Bob\",\"id\":1,\"score\":1.5},\n{\"data\":null,\"name\":\"Smith, \\\"J\\\"\",\"id\":2,\"score\":null}\n]\n",
+		},
+		{
+			name:     "ndjson",
+			opts:     Options{Format: NDJSON, Blobs: Hex},
+			expected: "{\"data\":\"00ff10\",\"name\":\"Bob\",\"id\":1,\"score\":1.5}\n{\"data\":null,\"name\":\"Smith, \\\"J\\\"\",\"id\":2,\"score\":null}\n",
+		},
+	}
+	for _, test := range tests {
+		rows, err := db.Query("SELECT data, name, id, score FROM t ORDER BY id")
+		if err != nil {
+			t.Fatalf("Error querying: %s", err)
+		}
+		buf := new(bytes.Buffer)
+		n, err := Rows(buf, rows, test.opts)
+		if err != nil {
+			t.Fatalf("%s: error exporting: %s", test.name, err)
+		}
+		if n != 2 {
+			t.Errorf("%s: exported %d rows, expected 2", test.name, n)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("%s: unexpected output:\n%s\nexpected:\n%s", test.name, buf.String(), test.expected)
+		}
+	}
+}
+
+func TestStatement(t *testing.T) {
+	db := bindings.New()
+	defer db.Close()
+	if err := db.Run(testData); err != nil {
+		t.Fatalf("Error creating test data: %s", err)
+	}
+	stmt, err := db.Prepare("SELECT id, data FROM t WHERE id > ? ORDER BY id")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	defer stmt.Free()
+	if err := stmt.Bind([]interface{}{0}); err != nil {
+		t.Fatalf("Error binding: %s", err)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := Statement(buf, stmt, Options{Format: NDJSON}); err != nil {
+		t.Fatalf("Error exporting: %s", err)
+	}
+	expected := "{\"id\":1,\"data\":\"AP8Q\"}\n{\"id\":2,\"data\":null}\n"
+	if buf.String() != expected {
+		t.Fatalf("Unexpected output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if _, err := Statement(buf, stmt, Options{Format: JSON}); err != nil {
+		t.Fatalf("Error exporting empty result: %s", err)
+	}
+	if buf.String() != "[]\n" {
+		t.Fatalf("Unexpected output for empty result: %s", buf.String())
+	}
+}
@@ -0,0 +1,45 @@
+// +build js
+
+package export
+
+import (
+	"io"
+
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+type statementSource struct {
+	*bindings.Statement
+	err error
+}
+
+func (s *statementSource) Columns() ([]string, error) {
+	return s.GetColumnNames()
+}
+
+func (s *statementSource) Next() bool {
+	ok, err := s.Step()
+	s.err = err
+	return ok
+}
+
+func (s *statementSource) Values() ([]interface{}, error) {
+	return s.Get()
+}
+
+func (s *statementSource) Err() error {
+	return s.err
+}
+
+// FromStatement returns a Source which steps through stmt, which must have
+// been prepared, and have had its parameters bound.
+func FromStatement(stmt *bindings.Statement) Source {
+	return &statementSource{Statement: stmt}
+}
+
+// Statement steps through stmt, writing its rows to w, and then resets it. It
+// returns the number of rows written.
+func Statement(w io.Writer, stmt *bindings.Statement, opts Options) (int, error) {
+	defer stmt.Reset()
+	return Write(w, FromStatement(stmt), opts)
+}
@@ -0,0 +1,273 @@
+// Package fts maintains full-text search indexes over tables of an SQLite
+// database, such as one opened with the sqljs driver, and searches them.
+//
+// An Index is an external-content FTS virtual table mirroring some columns
+// of a content table, kept up to date by triggers. FTS5 is used when the
+// SQLite build includes it, and FTS4 otherwise. With FTS4, which lacks
+// built-in ranking and highlighting, results are highlighted in Go, and
+// ranked by an approximation of FTS5's BM25 computed from matchinfo(), so
+// the order of results may differ between the two.
+//
+//    ix := &fts.Index{DB: db, Name: "docs_fts", Table: "docs", Columns: []string{"title", "body"}}
+//    if err := ix.Create(); err != nil {
+//        return err
+//    }
+//    results, err := ix.Search(fts.Escape(userInput), fts.SearchOptions{Limit: 20, Snippet: true})
+package fts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// Version is an FTS module version.
+type Version int
+
+const (
+	// Auto selects FTS5 if available, and FTS4 otherwise.
+	Auto Version = iota
+	// FTS4 uses the FTS4 module.
+	FTS4
+	// FTS5 uses the FTS5 module.
+	FTS5
+)
+
+func (v Version) String() string {
+	switch v {
+	case FTS4:
+		return "fts4"
+	case FTS5:
+		return "fts5"
+	}
+	return "auto"
+}
+
+// ErrUnsupported is returned when the SQLite build includes neither FTS5 nor
+// FTS4.
+var ErrUnsupported = errors.New("fts: full-text search is not available")
+
+// Detect returns the most recent FTS version supported by the database.
+func Detect(db *sql.DB) (Version, error) {
+	rows, err := db.Query("SELECT compile_options FROM pragma_compile_options")
+	if err != nil {
+		return Auto, err
+	}
+	defer rows.Close()
+	found := Auto
+	for rows.Next() {
+		var opt string
+		if err := rows.Scan(&opt); err != nil {
+			return Auto, err
+		}
+		switch opt {
+		case "ENABLE_FTS5":
+			found = FTS5
+		case "ENABLE_FTS3", "ENABLE_FTS4":
+			if found == Auto {
+				found = FTS4
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Auto, err
+	}
+	if found == Auto {
+		return Auto, ErrUnsupported
+	}
+	return found, nil
+}
+
+// Index is a full-text index over columns of a content table. The content
+// table must have a rowid.
+type Index struct {
+	DB *sql.DB
+	// Name is the name of the FTS virtual table.
+	Name string
+	// Table is the name of the content table.
+	Table string
+	// Columns are the indexed columns of the content table.
+	Columns []string
+	// Version selects the FTS module. If Auto, Create uses the version
+	// reported by Detect, and other methods the version of the existing
+	// table.
+	Version Version
+	// Tokenize, if set, is the tokenizer specification, such as "porter"
+	// or "unicode61 remove_diacritics 2".
+	Tokenize string
+}
+
+func (ix *Index) triggerName(event string) string {
+	return ix.Name + "_" + event
+}
+
+var events = []string{"insert", "delete", "update", "before_delete", "before_update"}
+
+// Create creates the FTS table and the triggers which keep it in sync with
+// the content table, if they do not already exist, and indexes the existing
+// content.
+func (ix *Index) Create() (err error) {
+	if ix.Version == Auto {
+		if ix.Version, err = Detect(ix.DB); err != nil {
+			return err
+		}
+	}
+	tx, err := ix.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	cols := make([]string, len(ix.Columns))
+	newCols := make([]string, len(ix.Columns))
+	oldCols := make([]string, len(ix.Columns))
+	for i, c := range ix.Columns {
+		cols[i] = script.QuoteIdent(c)
+		newCols[i] = "NEW." + script.QuoteIdent(c)
+		oldCols[i] = "OLD." + script.QuoteIdent(c)
+	}
+	args := append([]string{}, cols...)
+	args = append(args, "content="+script.Literal(ix.Table))
+	if ix.Version == FTS5 {
+		args = append(args, "content_rowid='rowid'")
+	}
+	if ix.Tokenize != "" {
+		if ix.Version == FTS5 {
+			args = append(args, "tokenize="+script.Literal(ix.Tokenize))
+		} else {
+			args = append(args, "tokenize="+ix.Tokenize)
+		}
+	}
+	name, table := script.QuoteIdent(ix.Name), script.QuoteIdent(ix.Table)
+	colList := strings.Join(cols, ", ")
+	stmts := []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %s USING %s(%s)", name, ix.Version, strings.Join(args, ", ")),
+	}
+	trigger := func(event, when, body string) string {
+		return fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s %s ON %s BEGIN %s END",
+			script.QuoteIdent(ix.triggerName(event)), when, table, body)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (rowid, %s) VALUES (NEW.rowid, %s);", name, colList, strings.Join(newCols, ", "))
+	if ix.Version == FTS5 {
+		remove := fmt.Sprintf("INSERT INTO %s (%s, rowid, %s) VALUES ('delete', OLD.rowid, %s);",
+			name, name, colList, strings.Join(oldCols, ", "))
+		stmts = append(stmts,
+			trigger("insert", "AFTER INSERT", insert),
+			trigger("delete", "AFTER DELETE", remove),
+			trigger("update", "AFTER UPDATE", remove+" "+insert),
+		)
+	} else {
+		// FTS4 reads the old values from the content table, so they must
+		// be removed before the content changes.
+		remove := fmt.Sprintf("DELETE FROM %s WHERE docid = OLD.rowid;", name)
+		stmts = append(stmts,
+			trigger("insert", "AFTER INSERT", insert),
+			trigger("before_delete", "BEFORE DELETE", remove),
+			trigger("before_update", "BEFORE UPDATE", remove),
+			trigger("update", "AFTER UPDATE", insert),
+		)
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("fts: %w", err)
+		}
+	}
+	return ix.rebuild(tx)
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (ix *Index) rebuild(e execer) error {
+	name := script.QuoteIdent(ix.Name)
+	_, err := e.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES ('rebuild')", name, name))
+	return err
+}
+
+// Rebuild reindexes the whole content table. It is only needed if the
+// content table was modified while the triggers were missing.
+func (ix *Index) Rebuild() error {
+	return ix.rebuild(ix.DB)
+}
+
+// Optimize merges the index's internal b-trees, which speeds up queries.
+func (ix *Index) Optimize() error {
+	name := script.QuoteIdent(ix.Name)
+	_, err := ix.DB.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES ('optimize')", name, name))
+	return err
+}
+
+// Drop removes the FTS table and its triggers. The content table is left
+// unchanged.
+func (ix *Index) Drop() error {
+	for _, event := range events {
+		if _, err := ix.DB.Exec("DROP TRIGGER IF EXISTS " + script.QuoteIdent(ix.triggerName(event))); err != nil {
+			return err
+		}
+	}
+	_, err := ix.DB.Exec("DROP TABLE IF EXISTS " + script.QuoteIdent(ix.Name))
+	return err
+}
+
+// version returns the version of the existing FTS table.
+func (ix *Index) version() (Version, error) {
+	if ix.Version != Auto {
+		return ix.Version, nil
+	}
+	var def string
+	err := ix.DB.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", ix.Name).Scan(&def)
+	if err == sql.ErrNoRows {
+		return Auto, fmt.Errorf("fts: no such index: %s", ix.Name)
+	} else if err != nil {
+		return Auto, err
+	}
+	if strings.Contains(strings.ToLower(def), "using fts5") {
+		ix.Version = FTS5
+	} else {
+		ix.Version = FTS4
+	}
+	return ix.Version, nil
+}
+
+// Escape converts user input into a query which matches rows containing
+// all of its words, without interpreting any of the query syntax.
+func Escape(input string) string {
+	return escape(input, Auto)
+}
+
+// EscapePrefix is like Escape, but also matches words beginning with the
+// last word of the input, which suits search-as-you-type. The syntax of
+// prefix queries depends on the version of the index, which is detected if
+// ix.Version is Auto.
+func (ix *Index) EscapePrefix(input string) (string, error) {
+	version, err := ix.version()
+	if err != nil {
+		return "", err
+	}
+	return escape(input, version), nil
+}
+
+func escape(input string, prefix Version) string {
+	words := strings.Fields(strings.Replace(input, `"`, " ", -1))
+	for i, w := range words {
+		if prefix != Auto && i == len(words)-1 {
+			if prefix == FTS5 {
+				words[i] = `"` + w + `"*`
+			} else {
+				words[i] = `"` + w + `*"`
+			}
+			continue
+		}
+		words[i] = `"` + w + `"`
+	}
+	return strings.Join(words, " ")
+}
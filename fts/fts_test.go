@@ -0,0 +1,146 @@
+// +build js
+
+package fts
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/go-sql.js"
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+func testDB(t *testing.T) (*sql.DB, func()) {
+	bdb := bindings.New()
+	if err := bdb.Run(`CREATE TABLE docs (id INTEGER PRIMARY KEY, title TEXT, body TEXT);
+INSERT INTO docs VALUES
+	(1, 'Go bindings', 'GopherJS bindings for SQL.js, which runs SQLite in the browser.'),
+	(2, 'SQLite', 'SQLite is an embedded database. SQLite is everywhere; SQLite SQLite.'),
+	(3, 'Cooking', 'How to bake bread without a database.')`); err != nil {
+		t.Fatalf("Error creating test data: %s", err)
+	}
+	db := sqljs.OpenDB(bdb)
+	return db, func() {
+		db.Close()
+		bdb.Close()
+	}
+}
+
+func TestDetect(t *testing.T) {
+	db, done := testDB(t)
+	defer done()
+	v, err := Detect(db)
+	if err == ErrUnsupported {
+		t.Skip("FTS not available")
+	}
+	if err != nil {
+		t.Fatalf("Error detecting FTS: %s", err)
+	}
+	t.Logf("Detected %s", v)
+}
+
+func TestSearch(t *testing.T) {
+	for _, version := range []Version{FTS5, FTS4} {
+		t.Run(version.String(), func(t *testing.T) {
+			db, done := testDB(t)
+			defer done()
+			ix := &Index{DB: db, Name: "docs_fts", Table: "docs", Columns: []string{"title", "body"}, Version: version}
+			if err := ix.Create(); err != nil {
+				if strings.Contains(err.Error(), "no such module") {
+					t.Skipf("%s not available", version)
+				}
+				t.Fatalf("Error creating index: %s", err)
+			}
+
+			results, err := ix.Search(Escape("sqlite"), SearchOptions{Highlight: true, Snippet: true})
+			if err != nil {
+				t.Fatalf("Error searching: %s", err)
+			}
+			if len(results) != 2 || results[0].Rowid != 2 || results[1].Rowid != 1 {
+				t.Fatalf("Unexpected results: %+v", results)
+			}
+			if results[0].Rank >= results[1].Rank {
+				t.Errorf("Results not ranked: %+v", results)
+			}
+			if results[0].Highlights[0] != "<b>SQLite</b>" {
+				t.Errorf("Unexpected highlight: %q", results[0].Highlights[0])
+			}
+			if !strings.Contains(results[1].Snippet, "<b>SQLite</b>") {
+				t.Errorf("Unexpected snippet: %q", results[1].Snippet)
+			}
+
+			// The triggers keep the index up to date.
+			if _, err := db.Exec(`UPDATE docs SET body = 'Sourdough uses SQLite now.' WHERE id = 3;
+DELETE FROM docs WHERE id = 2`); err != nil {
+				t.Fatalf("Error modifying content: %s", err)
+			}
+			results, err = ix.Search(Escape("sqlite"), SearchOptions{Limit: 1, Offset: 1})
+			if err != nil {
+				t.Fatalf("Error searching: %s", err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("Unexpected results: %+v", results)
+			}
+			if results, _ := ix.Search(Escape("bread"), SearchOptions{}); len(results) != 0 {
+				t.Errorf("Stale results after update: %+v", results)
+			}
+
+			// User input is not interpreted as query syntax.
+			if _, err := ix.Search(Escape(`"sqlite" AND (OR NEAR`), SearchOptions{}); err != nil {
+				t.Errorf("Error searching for escaped input: %s", err)
+			}
+			if results, err := ix.Search(Escape(" "), SearchOptions{}); err != nil || len(results) != 0 {
+				t.Errorf("Unexpected results for an empty query: %+v, %v", results, err)
+			}
+
+			// An index opened later detects its version.
+			other := &Index{DB: db, Name: "docs_fts", Table: "docs", Columns: ix.Columns}
+			prefix, err := other.EscapePrefix("goph")
+			if err != nil || other.Version != version {
+				t.Fatalf("Unexpected version %s, %v", other.Version, err)
+			}
+			results, err = other.Search(prefix, SearchOptions{})
+			if err != nil || len(results) != 1 || results[0].Rowid != 1 {
+				t.Errorf("Unexpected prefix results: %+v, %v", results, err)
+			}
+			if err := ix.Drop(); err != nil {
+				t.Fatalf("Error dropping index: %s", err)
+			}
+			if _, err := db.Exec("INSERT INTO docs (title) VALUES ('after drop')"); err != nil {
+				t.Fatalf("Error inserting after drop: %s", err)
+			}
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct{ input, plain, prefix5, prefix4 string }{
+		{"hello world", `"hello" "world"`, `"hello" "world"*`, `"hello" "world*"`},
+		{` say "hi" OR * `, `"say" "hi" "OR" "*"`, `"say" "hi" "OR" "*"*`, `"say" "hi" "OR" "**"`},
+		{"", "", "", ""},
+	}
+	for _, test := range tests {
+		if got := Escape(test.input); got != test.plain {
+			t.Errorf("Escape(%q) = %q, expected %q", test.input, got, test.plain)
+		}
+		if got := escape(test.input, FTS5); got != test.prefix5 {
+			t.Errorf("escape(%q, FTS5) = %q, expected %q", test.input, got, test.prefix5)
+		}
+		if got := escape(test.input, FTS4); got != test.prefix4 {
+			t.Errorf("escape(%q, FTS4) = %q, expected %q", test.input, got, test.prefix4)
+		}
+	}
+}
+
+func TestNoSuchIndex(t *testing.T) {
+	db, done := testDB(t)
+	defer done()
+	ix := &Index{DB: db, Name: "missing", Table: "docs", Columns: []string{"title"}}
+	if _, err := ix.Search(Escape("sqlite"), SearchOptions{}); err == nil || !strings.Contains(err.Error(), "no such index") {
+		t.Errorf("Expected a no such index error, got %v", err)
+	}
+	if _, err := ix.EscapePrefix("sql"); err == nil {
+		t.Errorf("Expected an error for a missing index")
+	}
+}
@@ -0,0 +1,312 @@
+package fts
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// SearchOptions configure a search.
+type SearchOptions struct {
+	// Limit is the maximum number of results. If 0, all matches are
+	// returned.
+	Limit  int
+	Offset int
+	// Weights are the BM25 weights of the indexed columns, in order. Missing
+	// weights default to 1.
+	Weights []float64
+	// Highlight fills Result.Highlights.
+	Highlight bool
+	// Snippet fills Result.Snippet.
+	Snippet bool
+	// Open and Close surround matched terms in highlights and snippets. They
+	// default to "<b>" and "</b>".
+	Open, Close string
+	// Ellipsis marks text omitted from snippets. It defaults to "…".
+	Ellipsis string
+	// SnippetTokens is the approximate number of tokens in a snippet. It
+	// defaults to 15, and may be at most 64.
+	SnippetTokens int
+}
+
+func (o *SearchOptions) defaults() {
+	if o.Open == "" && o.Close == "" {
+		o.Open, o.Close = "<b>", "</b>"
+	}
+	if o.Ellipsis == "" {
+		o.Ellipsis = "…"
+	}
+	if o.SnippetTokens <= 0 {
+		o.SnippetTokens = 15
+	}
+	if o.SnippetTokens > 64 {
+		o.SnippetTokens = 64
+	}
+}
+
+func (o *SearchOptions) weight(col int) float64 {
+	if col < len(o.Weights) {
+		return o.Weights[col]
+	}
+	return 1
+}
+
+// Result is a row matching a search.
+type Result struct {
+	// Rowid is the rowid of the matching row of the content table.
+	Rowid int64
+	// Rank is the BM25 score of the row. As with FTS5, better matches have
+	// lower (more negative) scores. Results are ordered by Rank.
+	Rank float64
+	// Highlights are the values of the indexed columns, with matched terms
+	// surrounded by SearchOptions.Open and Close.
+	Highlights []string
+	// Snippet is a short extract of the best matching column.
+	Snippet string
+}
+
+// Search returns the rows matching an FTS query, best matches first. Use
+// Escape to search for user input. An empty query matches no rows.
+func (ix *Index) Search(query string, opts SearchOptions) ([]Result, error) {
+	version, err := ix.version()
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+	opts.defaults()
+	if version == FTS5 {
+		return ix.search5(query, opts)
+	}
+	return ix.search4(query, opts)
+}
+
+func (ix *Index) search5(query string, opts SearchOptions) ([]Result, error) {
+	name := script.QuoteIdent(ix.Name)
+	weights := make([]string, len(ix.Columns))
+	for i := range ix.Columns {
+		weights[i] = strconv.FormatFloat(opts.weight(i), 'g', -1, 64)
+	}
+	rank := fmt.Sprintf("bm25(%s, %s)", name, strings.Join(weights, ", "))
+	cols := []string{"rowid", rank}
+	args := []interface{}{}
+	if opts.Highlight {
+		for i := range ix.Columns {
+			cols = append(cols, fmt.Sprintf("highlight(%s, %d, ?, ?)", name, i))
+			args = append(args, opts.Open, opts.Close)
+		}
+	}
+	if opts.Snippet {
+		cols = append(cols, fmt.Sprintf("snippet(%s, -1, ?, ?, ?, %d)", name, opts.SnippetTokens))
+		args = append(args, opts.Open, opts.Close, opts.Ellipsis)
+	}
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s MATCH ? ORDER BY %s", strings.Join(cols, ", "), name, name, rank)
+	args = append(args, query)
+	if opts.Limit > 0 || opts.Offset > 0 {
+		limit := opts.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		q += " LIMIT ? OFFSET ?"
+		args = append(args, limit, opts.Offset)
+	}
+	rows, err := ix.DB.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("fts: %w", err)
+	}
+	defer rows.Close()
+	var results []Result
+	for rows.Next() {
+		var r Result
+		dest := []interface{}{&r.Rowid, &r.Rank}
+		if opts.Highlight {
+			r.Highlights = make([]string, len(ix.Columns))
+			for i := range r.Highlights {
+				dest = append(dest, &nullString{&r.Highlights[i]})
+			}
+		}
+		if opts.Snippet {
+			dest = append(dest, &nullString{&r.Snippet})
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// search4 implements Search for FTS4, which has no built-in ranking
+// function, so results are scored from matchinfo() and sorted in Go.
+func (ix *Index) search4(query string, opts SearchOptions) ([]Result, error) {
+	name := script.QuoteIdent(ix.Name)
+	cols := []string{"rowid", fmt.Sprintf("matchinfo(%s, 'pcnalx')", name)}
+	var args []interface{}
+	if opts.Highlight {
+		cols = append(cols, fmt.Sprintf("offsets(%s)", name))
+		for _, c := range ix.Columns {
+			cols = append(cols, script.QuoteIdent(c))
+		}
+	}
+	if opts.Snippet {
+		cols = append(cols, fmt.Sprintf("snippet(%s, ?, ?, ?, -1, %d)", name, opts.SnippetTokens))
+		args = append(args, opts.Open, opts.Close, opts.Ellipsis)
+	}
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s MATCH ?", strings.Join(cols, ", "), name, name)
+	rows, err := ix.DB.Query(q, append(args, query)...)
+	if err != nil {
+		return nil, fmt.Errorf("fts: %w", err)
+	}
+	defer rows.Close()
+	var results []Result
+	for rows.Next() {
+		var r Result
+		var info []byte
+		var offsets string
+		texts := make([]string, len(ix.Columns))
+		dest := []interface{}{&r.Rowid, &info}
+		if opts.Highlight {
+			dest = append(dest, &offsets)
+			for i := range texts {
+				dest = append(dest, &nullString{&texts[i]})
+			}
+		}
+		if opts.Snippet {
+			dest = append(dest, &nullString{&r.Snippet})
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if r.Rank, err = bm25(info, &opts); err != nil {
+			return nil, err
+		}
+		if opts.Highlight {
+			r.Highlights = highlight(texts, offsets, opts.Open, opts.Close)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Rank < results[j].Rank })
+	if opts.Offset >= len(results) {
+		return nil, nil
+	}
+	results = results[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(results) {
+		results = results[:opts.Limit]
+	}
+	return results, nil
+}
+
+// nullString scans NULL as an empty string.
+type nullString struct {
+	s *string
+}
+
+func (n *nullString) Scan(v interface{}) error {
+	switch t := v.(type) {
+	case nil:
+		*n.s = ""
+	case string:
+		*n.s = t
+	case []byte:
+		*n.s = string(t)
+	default:
+		*n.s = fmt.Sprint(t)
+	}
+	return nil
+}
+
+// BM25 parameters, as used by FTS5.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// bm25 computes the BM25 score of a row from the output of
+// matchinfo(..., 'pcnalx'), negated, with the formula of FTS5's bm25(): the
+// weighted hits of each phrase in all columns are scored against the length
+// of the whole row. The result is an approximation, as matchinfo() reports
+// average column lengths rounded down, and the number of rows containing a
+// phrase only per column; the largest of those counts is used.
+func bm25(info []byte, opts *SearchOptions) (float64, error) {
+	if len(info)%4 != 0 || len(info) < 12 {
+		return 0, fmt.Errorf("fts: invalid matchinfo")
+	}
+	values := make([]float64, len(info)/4)
+	for i := range values {
+		values[i] = float64(binary.LittleEndian.Uint32(info[4*i:]))
+	}
+	p, c, n := int(values[0]), int(values[1]), values[2]
+	if len(values) != 3+2*c+3*p*c {
+		return 0, fmt.Errorf("fts: invalid matchinfo")
+	}
+	avg, length, x := values[3:3+c], values[3+c:3+2*c], values[3+2*c:]
+	avgRow, rowLength := 0.0, 0.0
+	for j := 0; j < c; j++ {
+		avgRow += avg[j]
+		rowLength += length[j]
+	}
+	norm := 1.0
+	if avgRow > 0 {
+		norm = 1 - bm25B + bm25B*rowLength/avgRow
+	}
+	score := 0.0
+	for i := 0; i < p; i++ {
+		freq, docs := 0.0, 0.0
+		for j := 0; j < c; j++ {
+			freq += opts.weight(j) * x[3*(i*c+j)]
+			docs = math.Max(docs, x[3*(i*c+j)+2])
+		}
+		idf := math.Log((n - docs + 0.5) / (docs + 0.5))
+		if idf <= 0 {
+			idf = 1e-6
+		}
+		score += idf * freq * (bm25K1 + 1) / (freq + bm25K1*norm)
+	}
+	return -score, nil
+}
+
+// highlight surrounds the matches reported by offsets() in each column's
+// text.
+func highlight(texts []string, offsets, open, close string) []string {
+	type match struct{ start, end int }
+	matches := make([][]match, len(texts))
+	fields := strings.Fields(offsets)
+	for i := 0; i+3 < len(fields); i += 4 {
+		col, err1 := strconv.Atoi(fields[i])
+		start, err2 := strconv.Atoi(fields[i+2])
+		size, err3 := strconv.Atoi(fields[i+3])
+		if err1 != nil || err2 != nil || err3 != nil || col < 0 || col >= len(texts) {
+			continue
+		}
+		matches[col] = append(matches[col], match{start, start + size})
+	}
+	result := make([]string, len(texts))
+	for col, text := range texts {
+		ms := matches[col]
+		sort.Slice(ms, func(i, j int) bool { return ms[i].start < ms[j].start })
+		var b strings.Builder
+		pos := 0
+		for _, m := range ms {
+			if m.start < pos || m.end > len(text) {
+				continue
+			}
+			b.WriteString(text[pos:m.start])
+			b.WriteString(open)
+			b.WriteString(text[m.start:m.end])
+			b.WriteString(close)
+			pos = m.end
+		}
+		b.WriteString(text[pos:])
+		result[col] = b.String()
+	}
+	return result
+}
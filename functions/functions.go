@@ -0,0 +1,235 @@
+// Package functions provides SQL functions, implemented in Go, which SQL.js
+// lacks. They are opt-in, and registered on each connection, most simply
+// with the driver's ConnectHook:
+//
+//    sql.Register("sqljs-functions", &sqljs.SQLJSDriver{ConnectHook: functions.Register})
+//    db, err := sql.Open("sqljs-functions", "")
+//
+// The functions are:
+//
+//    regexp(pattern, text)        1 if text matches the Go regular expression
+//                                 pattern, so that "text REGEXP pattern" works
+//    lower(text), upper(text)     Unicode-aware case conversion, replacing the
+//                                 ASCII-only built-in functions
+//    levenshtein(a, b)            the edit distance between a and b, in runes
+//    uuid()                       a random (version 4) UUID
+//    go_strftime(layout, time)    time formatted with a Go time layout, such
+//                                 as '2006-01-02 15:04'
+//
+// go_strftime accepts times as Unix timestamps in seconds, as text in the
+// formats understood by SQLite's date and time functions, or as 'now'. Times
+// are formatted in UTC.
+//
+// All functions return NULL if any argument is NULL.
+package functions
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Function is an SQL function implemented in Go.
+type Function struct {
+	Name string
+	// NArg is the number of arguments the function takes.
+	NArg int
+	Func func(args []interface{}) (interface{}, error)
+}
+
+// Functions returns the functions in the pack.
+func Functions() []Function {
+	return []Function{
+		{"regexp", 2, Regexp},
+		{"lower", 1, Lower},
+		{"upper", 1, Upper},
+		{"levenshtein", 2, Levenshtein},
+		{"uuid", 0, UUID},
+		{"go_strftime", 2, GoStrftime},
+	}
+}
+
+func hasNull(args []interface{}) bool {
+	for _, a := range args {
+		if a == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// text converts an SQL value to text, as SQLite does.
+func text(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	case float64:
+		if t == math.Trunc(t) && math.Abs(t) < 1e15 {
+			return strconv.FormatInt(int64(t), 10)
+		}
+		return strconv.FormatFloat(t, 'g', 15, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+var (
+	regexpMu    sync.Mutex
+	regexpCache = make(map[string]*regexp.Regexp)
+)
+
+// maxCachedRegexps bounds the number of compiled patterns kept by Regexp.
+const maxCachedRegexps = 64
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	regexpMu.Lock()
+	defer regexpMu.Unlock()
+	if re, ok := regexpCache[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(regexpCache) >= maxCachedRegexps {
+		regexpCache = make(map[string]*regexp.Regexp)
+	}
+	regexpCache[pattern] = re
+	return re, nil
+}
+
+// Regexp implements regexp(pattern, text), which SQLite calls for the
+// REGEXP operator.
+func Regexp(args []interface{}) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	re, err := compile(text(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(text(args[1])), nil
+}
+
+func convertCase(args []interface{}, fn func(string) string) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	return fn(text(args[0])), nil
+}
+
+// Lower implements lower(text).
+func Lower(args []interface{}) (interface{}, error) {
+	return convertCase(args, strings.ToLower)
+}
+
+// Upper implements upper(text).
+func Upper(args []interface{}) (interface{}, error) {
+	return convertCase(args, strings.ToUpper)
+}
+
+// Levenshtein implements levenshtein(a, b).
+func Levenshtein(args []interface{}) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	return int64(levenshtein(text(args[0]), text(args[1]))), nil
+}
+
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(t)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// UUID implements uuid().
+func UUID(args []interface{}) (interface{}, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// timeFormats are the text formats accepted by SQLite's date and time
+// functions.
+var timeFormats = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"15:04:05.999999999",
+	"15:04",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+}
+
+// errInvalidTime is returned by GoStrftime for unrecognized times.
+var errInvalidTime = errors.New("invalid time")
+
+func parseTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case float64:
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	case int64:
+		return time.Unix(t, 0).UTC(), nil
+	}
+	s := strings.TrimSpace(text(v))
+	if strings.EqualFold(s, "now") {
+		return time.Now().UTC(), nil
+	}
+	for _, layout := range timeFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errInvalidTime
+}
+
+// GoStrftime implements go_strftime(layout, time).
+func GoStrftime(args []interface{}) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	t, err := parseTime(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return t.Format(text(args[0])), nil
+}
@@ -0,0 +1,53 @@
+package functions
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestFunctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       func([]interface{}) (interface{}, error)
+		args     []interface{}
+		expected interface{}
+	}{
+		{"regexp match", Regexp, []interface{}{"^a.c$", "abc"}, true},
+		{"regexp no match", Regexp, []interface{}{"^a.c$", "abcd"}, false},
+		{"regexp number", Regexp, []interface{}{`^\d+$`, 42.0}, true},
+		{"regexp null", Regexp, []interface{}{"a", nil}, nil},
+		{"lower", Lower, []interface{}{"ÀÉÎ ABC"}, "àéî abc"},
+		{"upper", Upper, []interface{}{"ÿéa"}, "ŸÉA"},
+		{"upper number", Upper, []interface{}{1.5}, "1.5"},
+		{"levenshtein", Levenshtein, []interface{}{"kitten", "sitting"}, int64(3)},
+		{"levenshtein runes", Levenshtein, []interface{}{"héllo", "hello"}, int64(1)},
+		{"levenshtein empty", Levenshtein, []interface{}{"", "abc"}, int64(3)},
+		{"strftime text", GoStrftime, []interface{}{"Jan 2, 2006 15:04", "2021-06-01 12:30:00"}, "Jun 1, 2021 12:30"},
+		{"strftime unix", GoStrftime, []interface{}{"2006-01-02T15:04:05Z07:00", 0.0}, "1970-01-01T00:00:00Z"},
+		{"strftime date", GoStrftime, []interface{}{"Monday", "2021-06-01"}, "Tuesday"},
+		{"strftime null", GoStrftime, []interface{}{"2006", nil}, nil},
+	}
+	for _, test := range tests {
+		got, err := test.fn(test.args)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%s: expected %#v, got %#v", test.name, test.expected, got)
+		}
+	}
+
+	if _, err := Regexp([]interface{}{"(", "x"}); err == nil {
+		t.Errorf("Expected error for invalid pattern")
+	}
+	if _, err := GoStrftime([]interface{}{"2006", "yesterday"}); err == nil {
+		t.Errorf("Expected error for invalid time")
+	}
+	a, _ := UUID(nil)
+	b, _ := UUID(nil)
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if !pattern.MatchString(a.(string)) || a == b {
+		t.Errorf("Unexpected UUIDs: %s, %s", a, b)
+	}
+}
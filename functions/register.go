@@ -0,0 +1,18 @@
+// +build js
+
+package functions
+
+import (
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+// Register registers all the functions on db. Its signature matches
+// SQLJSDriver.ConnectHook.
+func Register(db *bindings.Database) error {
+	for _, f := range Functions() {
+		if err := db.CreateFunction(f.Name, f.NArg, f.Func); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+// +build js
+
+package functions
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/go-sql.js"
+)
+
+func TestRegister(t *testing.T) {
+	sql.Register("sqljs-functions", &sqljs.SQLJSDriver{ConnectHook: Register})
+	db, err := sql.Open("sqljs-functions", "")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+
+	var match, distance int
+	var lower, uuid, formatted string
+	err = db.QueryRow(`SELECT 'abc123' REGEXP '^[a-z]+\d+$', lower('ÀÉÎ'), levenshtein('kitten', 'sitting'),
+		uuid(), go_strftime('02/01/2006', '2021-06-01')`).Scan(&match, &lower, &distance, &uuid, &formatted)
+	if err != nil {
+		t.Fatalf("Error calling functions: %s", err)
+	}
+	if match != 1 || lower != "àéî" || distance != 3 || len(uuid) != 36 || formatted != "01/06/2021" {
+		t.Errorf("Unexpected results: %d %q %d %q %q", match, lower, distance, uuid, formatted)
+	}
+
+	_, err = db.Exec("SELECT 'x' REGEXP '('")
+	if err == nil || !strings.Contains(err.Error(), "regexp") {
+		t.Errorf("Expected regexp error, got %v", err)
+	}
+
+	plain, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer plain.Close()
+	if _, err := plain.Exec("SELECT 'x' REGEXP 'x'"); err == nil {
+		t.Errorf("Expected functions to be opt-in")
+	}
+}
@@ -0,0 +1,448 @@
+// Package importer bulk-loads CSV, TSV, JSON and NDJSON data into a table of
+// an SQLite database, such as one opened with the sqljs driver.
+//
+//    result, err := importer.Import(db, file, importer.Options{
+//        Format:     importer.CSV,
+//        Table:      "people",
+//        InferTypes: true,
+//    })
+//
+// Rows are inserted with a prepared statement, in batches of BatchSize rows
+// per transaction. A row which cannot be parsed or inserted does not abort the
+// import; it is reported in Result.Errors instead.
+package importer
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// Format is the format of the input data.
+type Format int
+
+const (
+	// CSV is comma-separated values, as read by encoding/csv.
+	CSV Format = iota
+	// TSV is tab-separated values.
+	TSV
+	// JSON is a single JSON array, whose elements are either objects, or
+	// arrays of values.
+	JSON
+	// NDJSON is newline-delimited JSON: one object, or array of values, per
+	// line.
+	NDJSON
+)
+
+// DefaultBatchSize is the number of rows inserted per transaction when
+// Options.BatchSize is 0.
+const DefaultBatchSize = 1000
+
+// inferSample is the number of rows examined to infer column types.
+const inferSample = 1000
+
+// Options configure an import.
+type Options struct {
+	Format Format
+	// Table is the name of the table to import into. It is created if it
+	// does not exist.
+	Table string
+	// Columns names the columns of the input. If empty, names are taken from
+	// the header row (CSV and TSV), from the keys of the first object (JSON
+	// and NDJSON), or are generated as column1, column2, etc.
+	Columns []string
+	// NoHeader indicates that CSV or TSV input has no header row. For JSON
+	// input of arrays, a header row is never assumed.
+	NoHeader bool
+	// SkipRows is the number of rows (lines, for CSV and TSV) to skip before
+	// the header row, or before the data if there is no header.
+	SkipRows int
+	// InferTypes, when true, converts CSV and TSV fields which look like
+	// numbers to INTEGER or REAL values, and empty fields to NULL. When
+	// creating a table, column types are inferred from the first rows.
+	// Otherwise, columns of new tables have no declared type.
+	InferTypes bool
+	// BatchSize is the number of rows inserted per transaction. If 0,
+	// DefaultBatchSize is used.
+	BatchSize int
+	// MaxErrors is the number of row errors after which the import is
+	// aborted. If 0, the import is never aborted because of row errors.
+	MaxErrors int
+}
+
+// RowError is an error which occurred importing a single row.
+type RowError struct {
+	// Row is the 1-based number of the row within the input, not counting
+	// skipped or header rows.
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Err)
+}
+
+// Result reports the outcome of an import.
+type Result struct {
+	// Columns are the names of the columns imported.
+	Columns []string
+	// Inserted is the number of rows inserted.
+	Inserted int
+	// Errors are the rows which could not be imported.
+	Errors []*RowError
+}
+
+// ErrTooManyErrors is returned when an import is aborted because MaxErrors
+// was reached.
+var ErrTooManyErrors = errors.New("importer: too many errors")
+
+// record is a single parsed input row. Exactly one of values or fields is
+// set: values for positional data, fields for JSON objects.
+type record struct {
+	values []interface{}
+	fields map[string]interface{}
+	keys   []string // order of keys in fields
+	err    error
+}
+
+type recordReader interface {
+	// read returns the next record, or io.EOF.
+	read() (*record, error)
+}
+
+// Import reads r in the configured format, and inserts its rows into the
+// configured table.
+func Import(db *sql.DB, r io.Reader, opts Options) (*Result, error) {
+	if opts.Table == "" {
+		return nil, errors.New("importer: no table specified")
+	}
+	rr, header, err := newReader(r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Buffer enough rows to determine the columns, and their types.
+	var sample []*record
+	for len(sample) < inferSample {
+		rec, err := rr.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		sample = append(sample, rec)
+		if !opts.InferTypes && (len(opts.Columns) > 0 || header != nil) {
+			break
+		}
+	}
+	cols := columns(opts.Columns, header, sample)
+	if len(cols) == 0 {
+		return &Result{}, nil
+	}
+	if inferFields(opts) {
+		for _, rec := range sample {
+			inferValues(rec)
+		}
+	}
+	if err := createTable(db, opts.Table, cols, sample, opts.InferTypes); err != nil {
+		return nil, err
+	}
+
+	imp := &importRun{
+		db:      db,
+		opts:    opts,
+		cols:    cols,
+		result:  &Result{Columns: cols},
+		pending: sample,
+		reader:  rr,
+	}
+	return imp.result, imp.run()
+}
+
+func newReader(r io.Reader, opts Options) (recordReader, []string, error) {
+	switch opts.Format {
+	case CSV, TSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		if opts.Format == TSV {
+			cr.Comma = '\t'
+			cr.LazyQuotes = true
+		}
+		for i := 0; i < opts.SkipRows; i++ {
+			if _, err := cr.Read(); err != nil && err != io.EOF {
+				return nil, nil, err
+			}
+		}
+		var header []string
+		if !opts.NoHeader {
+			h, err := cr.Read()
+			if err != nil && err != io.EOF {
+				return nil, nil, err
+			}
+			header = h
+		}
+		return &csvReader{cr}, header, nil
+	case JSON:
+		jr, err := newJSONReader(r, opts.SkipRows)
+		return jr, nil, err
+	case NDJSON:
+		nr := newNDJSONReader(r)
+		for i := 0; i < opts.SkipRows; i++ {
+			if _, err := nr.read(); err != nil && err != io.EOF {
+				return nil, nil, err
+			}
+		}
+		return nr, nil, nil
+	}
+	return nil, nil, fmt.Errorf("importer: unknown format %d", opts.Format)
+}
+
+type csvReader struct {
+	r *csv.Reader
+}
+
+func (c *csvReader) read() (*record, error) {
+	fields, err := c.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		if _, ok := err.(*csv.ParseError); ok {
+			return &record{err: err}, nil
+		}
+		return nil, err
+	}
+	rec := &record{values: make([]interface{}, len(fields))}
+	for i, f := range fields {
+		rec.values[i] = f
+	}
+	return rec, nil
+}
+
+// columns determines the column names of the input.
+func columns(explicit, header []string, sample []*record) []string {
+	if len(explicit) > 0 {
+		return explicit
+	}
+	if header != nil {
+		return header
+	}
+	var cols []string
+	seen := make(map[string]bool)
+	for _, rec := range sample {
+		for _, key := range rec.keys {
+			if !seen[key] {
+				seen[key] = true
+				cols = append(cols, key)
+			}
+		}
+		for len(cols) < len(rec.values) {
+			cols = append(cols, "column"+strconv.Itoa(len(cols)+1))
+		}
+	}
+	return cols
+}
+
+// inferFields reports whether text fields should be converted to numbers.
+func inferFields(opts Options) bool {
+	return opts.InferTypes && (opts.Format == CSV || opts.Format == TSV)
+}
+
+// inferValues converts the string values of a record which look like numbers
+// to int64 or float64, and empty strings to nil.
+func inferValues(rec *record) {
+	for i, v := range rec.values {
+		if s, ok := v.(string); ok {
+			rec.values[i] = inferValue(s)
+		}
+	}
+}
+
+func inferValue(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// createTable creates the table if it does not exist, with column types
+// inferred from the sample if requested.
+func createTable(db *sql.DB, table string, cols []string, sample []*record, infer bool) error {
+	defs := make([]string, len(cols))
+	for i, col := range cols {
+		defs[i] = script.QuoteIdent(col)
+		if infer {
+			if typ := columnType(i, col, sample); typ != "" {
+				defs[i] += " " + typ
+			}
+		}
+	}
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS " + script.QuoteIdent(table) + " (" + strings.Join(defs, ", ") + ")")
+	return err
+}
+
+// columnType infers the type of a column from the sample: INTEGER if all
+// non-NULL values are integers, REAL if all are numbers, and TEXT otherwise.
+func columnType(i int, col string, sample []*record) string {
+	typ := ""
+	for _, rec := range sample {
+		var v interface{}
+		if rec.fields != nil {
+			v = rec.fields[col]
+		} else if i < len(rec.values) {
+			v = rec.values[i]
+		}
+		switch v.(type) {
+		case nil:
+			continue
+		case int64, bool:
+			if typ == "" {
+				typ = "INTEGER"
+			}
+		case float64:
+			if typ != "TEXT" {
+				typ = "REAL"
+			}
+		default:
+			return "TEXT"
+		}
+	}
+	return typ
+}
+
+type importRun struct {
+	db      *sql.DB
+	opts    Options
+	cols    []string
+	result  *Result
+	pending []*record
+	reader  recordReader
+	row     int
+}
+
+func (imp *importRun) next() (*record, error) {
+	if len(imp.pending) > 0 {
+		rec := imp.pending[0]
+		imp.pending = imp.pending[1:]
+		return rec, nil
+	}
+	rec, err := imp.reader.read()
+	if err == nil && inferFields(imp.opts) {
+		inferValues(rec)
+	}
+	return rec, err
+}
+
+func (imp *importRun) run() error {
+	batch := imp.opts.BatchSize
+	if batch <= 0 {
+		batch = DefaultBatchSize
+	}
+	for {
+		done, err := imp.batch(batch)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// batch inserts up to n rows in a single transaction. The rows are counted as
+// inserted only once the transaction is committed.
+func (imp *importRun) batch(n int) (done bool, err error) {
+	tx, err := imp.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	inserted := 0
+	defer func() {
+		if err != nil && err != ErrTooManyErrors {
+			tx.Rollback()
+			return
+		}
+		if cerr := tx.Commit(); cerr != nil {
+			err = cerr
+			return
+		}
+		imp.result.Inserted += inserted
+	}()
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(imp.cols)), ", ")
+	quoted := make([]string, len(imp.cols))
+	for i, col := range imp.cols {
+		quoted[i] = script.QuoteIdent(col)
+	}
+	stmt, err := tx.Prepare("INSERT INTO " + script.QuoteIdent(imp.opts.Table) +
+		" (" + strings.Join(quoted, ", ") + ") VALUES (" + placeholders + ")")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	for i := 0; i < n; i++ {
+		rec, err := imp.next()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		imp.row++
+		if rec.err == nil {
+			var args []interface{}
+			if args, rec.err = imp.args(rec); rec.err == nil {
+				_, rec.err = stmt.Exec(args...)
+			}
+		}
+		if rec.err != nil {
+			imp.result.Errors = append(imp.result.Errors, &RowError{Row: imp.row, Err: rec.err})
+			if max := imp.opts.MaxErrors; max > 0 && len(imp.result.Errors) >= max {
+				return false, ErrTooManyErrors
+			}
+			continue
+		}
+		inserted++
+	}
+	return false, nil
+}
+
+// args returns the values of rec in column order.
+func (imp *importRun) args(rec *record) ([]interface{}, error) {
+	args := make([]interface{}, len(imp.cols))
+	if rec.fields != nil {
+		for key := range rec.fields {
+			if !contains(imp.cols, key) {
+				return nil, fmt.Errorf("unknown column %q", key)
+			}
+		}
+		for i, col := range imp.cols {
+			args[i] = rec.fields[col]
+		}
+		return args, nil
+	}
+	if len(rec.values) != len(imp.cols) {
+		return nil, fmt.Errorf("expected %d fields, found %d", len(imp.cols), len(rec.values))
+	}
+	copy(args, rec.values)
+	return args, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+// +build js
+
+package importer
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	_ "github.com/flimzy/go-sql.js"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func dump(t *testing.T, db *sql.DB, query string) [][]interface{} {
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("Error querying: %s", err)
+	}
+	defer rows.Close()
+	cols, _ := rows.Columns()
+	var result [][]interface{}
+	for rows.Next() {
+		row := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatalf("Error scanning: %s", err)
+		}
+		result = append(result, row)
+	}
+	return result
+}
+
+func TestImportCSV(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	input := "Exported from spreadsheet\nname,age,score\nBob,42,1.5\nAlice,,2\n\"Smith, J\",x,3\nbroken\n"
+	result, err := Import(db, strings.NewReader(input), Options{
+		Table:      "people",
+		SkipRows:   1,
+		InferTypes: true,
+		BatchSize:  2,
+	})
+	if err != nil {
+		t.Fatalf("Error importing: %s", err)
+	}
+	if result.Inserted != 3 || len(result.Errors) != 1 || result.Errors[0].Row != 4 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	var sqlText string
+	if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE name='people'").Scan(&sqlText); err != nil {
+		t.Fatalf("Error reading schema: %s", err)
+	}
+	if sqlText != `CREATE TABLE "people" ("name" TEXT, "age" TEXT, "score" REAL)` {
+		t.Fatalf("Unexpected schema: %s", sqlText)
+	}
+	expected := [][]interface{}{
+		{"Bob", "42", 1.5},
+		{"Alice", nil, 2.0},
+		{"Smith, J", "x", 3.0},
+	}
+	if rows := dump(t, db, "SELECT name, age, score FROM people ORDER BY rowid"); !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Unexpected rows: %v", rows)
+	}
+}
+
+func TestImportTSVExistingTable(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE t (a TEXT, b TEXT NOT NULL)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	input := "1\t2\n3\t4\n"
+	result, err := Import(db, strings.NewReader(input), Options{
+		Format:   TSV,
+		Table:    "t",
+		NoHeader: true,
+		Columns:  []string{"a", "b"},
+	})
+	if err != nil {
+		t.Fatalf("Error importing: %s", err)
+	}
+	if result.Inserted != 2 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	expected := [][]interface{}{{"1", "2"}, {"3", "4"}}
+	if rows := dump(t, db, "SELECT a, b FROM t ORDER BY rowid"); !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Unexpected rows: %v", rows)
+	}
+}
+
+func TestImportReadError(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	errBroken := errors.New("broken reader")
+	input := io.MultiReader(strings.NewReader("1,2\n3,4\n"), iotest.ErrReader(errBroken))
+	result, err := Import(db, input, Options{
+		Table:    "t",
+		NoHeader: true,
+		Columns:  []string{"a", "b"},
+	})
+	if !errors.Is(err, errBroken) {
+		t.Fatalf("Expected the read error, got: %v", err)
+	}
+	if result.Inserted != 0 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if rows := dump(t, db, "SELECT a, b FROM t"); len(rows) != 0 {
+		t.Fatalf("Unexpected rows: %v", rows)
+	}
+}
+
+func TestImportJSON(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	input := `[{"id": 1, "name": "Bob", "tags": ["a"]}, {"id": 2, "name": "Alice", "active": true}, {"id": 3, "bogus": 1}]`
+	result, err := Import(db, strings.NewReader(input), Options{
+		Format:     JSON,
+		Table:      "users",
+		InferTypes: true,
+	})
+	if err != nil {
+		t.Fatalf("Error importing: %s", err)
+	}
+	if !reflect.DeepEqual(result.Columns, []string{"id", "name", "tags", "active", "bogus"}) {
+		t.Fatalf("Unexpected columns: %v", result.Columns)
+	}
+	if result.Inserted != 3 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	expected := [][]interface{}{
+		{int64(1), "Bob", `["a"]`, nil},
+		{int64(2), "Alice", nil, int64(1)},
+		{int64(3), nil, nil, nil},
+	}
+	if rows := dump(t, db, "SELECT id, name, tags, active FROM users ORDER BY rowid"); !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Unexpected rows: %v", rows)
+	}
+}
+
+func TestImportNDJSON(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	input := "{\"a\": 1}\n\nnot json\n{\"a\": 2, \"b\": 3}\n"
+	result, err := Import(db, strings.NewReader(input), Options{
+		Format:  NDJSON,
+		Table:   "t",
+		Columns: []string{"a"},
+	})
+	if err != nil {
+		t.Fatalf("Error importing: %s", err)
+	}
+	if result.Inserted != 1 || len(result.Errors) != 2 || result.Errors[0].Row != 2 || result.Errors[1].Row != 3 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+}
@@ -0,0 +1,136 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonReader reads the elements of a JSON array, one at a time.
+type jsonReader struct {
+	dec *json.Decoder
+}
+
+func newJSONReader(r io.Reader, skip int) (*jsonReader, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("importer: expected JSON array, found %v", tok)
+	}
+	jr := &jsonReader{dec: dec}
+	for i := 0; i < skip; i++ {
+		if _, err := jr.read(); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	return jr, nil
+}
+
+func (j *jsonReader) read() (*record, error) {
+	if !j.dec.More() {
+		return nil, io.EOF
+	}
+	var raw json.RawMessage
+	if err := j.dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return parseRecord(raw), nil
+}
+
+// ndjsonReader reads one JSON value per line. Blank lines are ignored.
+type ndjsonReader struct {
+	s *bufio.Scanner
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16*1024*1024)
+	return &ndjsonReader{s: s}
+}
+
+func (n *ndjsonReader) read() (*record, error) {
+	for n.s.Scan() {
+		line := bytes.TrimSpace(n.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		return parseRecord(append(json.RawMessage{}, line...)), nil
+	}
+	if err := n.s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// parseRecord parses a JSON object or array into a record. Syntax errors, and
+// other kinds of values, are returned as record errors.
+func parseRecord(raw json.RawMessage) *record {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return &record{err: err}
+	}
+	rec := &record{}
+	switch tok {
+	case json.Delim('{'):
+		rec.fields = make(map[string]interface{})
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return &record{err: err}
+			}
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return &record{err: err}
+			}
+			k := key.(string)
+			if _, ok := rec.fields[k]; !ok {
+				rec.keys = append(rec.keys, k)
+			}
+			rec.fields[k] = jsonValue(v)
+		}
+	case json.Delim('['):
+		for dec.More() {
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return &record{err: err}
+			}
+			rec.values = append(rec.values, jsonValue(v))
+		}
+		if rec.values == nil {
+			rec.values = []interface{}{}
+		}
+	default:
+		return &record{err: fmt.Errorf("expected JSON object or array, found %s", raw)}
+	}
+	return rec
+}
+
+// jsonValue converts a decoded JSON value to a value which can be bound as a
+// parameter. Nested objects and arrays are stored as JSON text.
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case bool:
+		if t {
+			return int64(1)
+		}
+		return int64(0)
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+	return v
+}
@@ -0,0 +1,87 @@
+package sqljs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// ScriptProgress reports the progress of ImportScript.
+type ScriptProgress struct {
+	// Statement is the 1-based index of the statement just executed.
+	Statement int
+	// Line is the line of the script on which the statement starts.
+	Line int
+	// Offset is the number of bytes of the script consumed so far.
+	Offset int64
+	// SQL is the text of the statement.
+	SQL string
+}
+
+// ScriptError is returned by ImportScript when a statement fails.
+type ScriptError struct {
+	// Statement is the 1-based index of the failing statement.
+	Statement int
+	// Line is the line of the script on which the statement starts.
+	Line int
+	// Offset is the byte offset of the statement within the script.
+	Offset int64
+	SQL    string
+	Err    error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("statement %d at line %d: %s", e.Statement, e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error, typically an *Error.
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// ImportScript reads an SQL script from r, and executes it one statement at
+// a time, on a single connection of db. Unlike Database.Run, the script is
+// never held in memory in its entirety. If progress is not nil, it is called
+// after each statement is executed.
+//
+// Execution stops at the first failing statement, and a *ScriptError is
+// returned. Statements already executed are not rolled back, unless the
+// script itself uses a transaction.
+func ImportScript(db *sql.DB, r io.Reader, progress func(ScriptProgress)) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	s := script.NewSplitter(r)
+	for i := 1; ; i++ {
+		stmt, err := s.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, stmt.SQL); err != nil {
+			return &ScriptError{
+				Statement: i,
+				Line:      stmt.Line,
+				Offset:    stmt.Offset,
+				SQL:       stmt.SQL,
+				Err:       err,
+			}
+		}
+		if progress != nil {
+			progress(ScriptProgress{
+				Statement: i,
+				Line:      stmt.Line,
+				Offset:    s.Offset(),
+				SQL:       stmt.SQL,
+			})
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// +build js
+
+// Package synctest provides the fixtures shared by the tests of the syncer
+// and couch packages: a database holding a tracked todos table, and an HTTP
+// client whose requests are served in-process.
+package synctest
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/go-sql.js"
+	"github.com/flimzy/go-sql.js/bindings"
+	"github.com/flimzy/go-sql.js/changelog"
+)
+
+// handlerTransport passes requests directly to a handler, since GopherJS
+// cannot listen on a network socket.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+// Client returns an HTTP client whose requests are served by handler.
+func Client(handler http.Handler) *http.Client {
+	return &http.Client{Transport: handlerTransport{handler}}
+}
+
+// NewLog creates a new in-memory database holding a todos table, tracked by
+// the returned changelog. The returned function closes the database.
+func NewLog(t testing.TB) (*changelog.Log, func()) {
+	bdb := bindings.New()
+	if err := bdb.Run("CREATE TABLE todos (id INTEGER PRIMARY KEY, title TEXT, done INTEGER NOT NULL DEFAULT 0)"); err != nil {
+		t.Fatalf("Error creating schema: %s", err)
+	}
+	db := sqljs.OpenDB(bdb)
+	log := &changelog.Log{DB: db}
+	if err := log.Track("todos"); err != nil {
+		t.Fatalf("Error tracking table: %s", err)
+	}
+	return log, func() {
+		db.Close()
+		bdb.Close()
+	}
+}
+
+// Exec executes query, failing the test if it fails.
+func Exec(t testing.TB, db *sql.DB, query string) {
+	if _, err := db.Exec(query); err != nil {
+		t.Fatalf("Error executing %q: %s", query, err)
+	}
+}
+
+// Todos returns the titles of the rows of the todos table, by id.
+func Todos(t testing.TB, db *sql.DB) map[int64]string {
+	rows, err := db.Query("SELECT id, title FROM todos")
+	if err != nil {
+		t.Fatalf("Error reading todos: %s", err)
+	}
+	defer rows.Close()
+	result := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			t.Fatalf("Error scanning: %s", err)
+		}
+		result[id] = title
+	}
+	return result
+}
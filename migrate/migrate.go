@@ -0,0 +1,364 @@
+// Package migrate applies schema migrations to an SQLite database, such as one
+// opened with the sqljs driver.
+//
+// Migrations are identified by a positive version number, and are applied in
+// order, each inside its own transaction. The version of the database is
+// recorded either in PRAGMA user_version (the default), or in a migrations
+// table.
+//
+//    m := &migrate.Migrator{
+//        DB: db,
+//        Migrations: []migrate.Migration{
+//            migrate.SQL(1, "create users", "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)", "DROP TABLE users"),
+//            {Version: 2, Name: "seed users", Up: seedUsers},
+//        },
+//    }
+//    applied, err := m.Up()
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// Migration is a single schema migration.
+type Migration struct {
+	// Version is the schema version the migration upgrades to. It must be
+	// positive, and unique among a Migrator's migrations.
+	Version int
+	// Name is a human-readable description of the migration.
+	Name string
+	// Up applies the migration.
+	Up func(tx *sql.Tx) error
+	// Down reverts the migration. It may be nil if the migration cannot be
+	// reverted.
+	Down func(tx *sql.Tx) error
+}
+
+// SQL returns a migration which executes the passed SQL scripts. down may be
+// empty if the migration cannot be reverted.
+func SQL(version int, name, up, down string) Migration {
+	m := Migration{Version: version, Name: name, Up: execScript(up)}
+	if down != "" {
+		m.Down = execScript(down)
+	}
+	return m
+}
+
+func execScript(script string) func(*sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(script)
+		return err
+	}
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(.*?)(\.(up|down))?\.sql$`)
+
+// FromFS reads SQL migrations from the directory dir of fsys, such as an
+// embed.FS. Files must be named <version>_<name>.up.sql, with an optional
+// corresponding <version>_<name>.down.sql. A file named <version>_<name>.sql
+// is treated as an up migration. Other files are ignored.
+func FromFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", entry.Name(), err)
+		}
+		script, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if match[4] == "down" {
+			m.Down = execScript(string(script))
+			continue
+		}
+		if m.Up != nil {
+			return nil, fmt.Errorf("migrate: duplicate migration version %d", version)
+		}
+		m.Up = execScript(string(script))
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == nil {
+			return nil, fmt.Errorf("migrate: migration %d has no up script", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sortMigrations(migrations)
+	return migrations, nil
+}
+
+func sortMigrations(migrations []Migration) {
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+// Direction is the direction in which a migration is applied.
+type Direction int
+
+const (
+	// Up applies a migration.
+	Up Direction = iota
+	// Down reverts a migration.
+	Down
+)
+
+func (d Direction) String() string {
+	if d == Down {
+		return "down"
+	}
+	return "up"
+}
+
+// ErrIrreversible is returned when reverting a migration which has no Down
+// function.
+var ErrIrreversible = errors.New("migrate: migration cannot be reverted")
+
+// Migrator applies a set of migrations to a database.
+type Migrator struct {
+	// DB is the database to migrate.
+	DB *sql.DB
+	// Migrations are the available migrations. They need not be sorted.
+	Migrations []Migration
+	// Table, if set, is the name of a table in which applied migrations are
+	// recorded, and which is created if necessary. Otherwise, the schema
+	// version is stored in PRAGMA user_version.
+	Table string
+	// DryRun, when true, causes all planned migrations to be executed in a
+	// single transaction which is then rolled back, leaving the database
+	// unchanged.
+	DryRun bool
+	// Log, if set, is called before each migration is applied or reverted.
+	Log func(m Migration, d Direction)
+}
+
+// Version returns the current schema version of the database.
+func (m *Migrator) Version() (int, error) {
+	return m.version(m.DB)
+}
+
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (m *Migrator) version(q queryer) (int, error) {
+	var version int
+	if m.Table == "" {
+		err := q.QueryRow("PRAGMA user_version").Scan(&version)
+		return version, err
+	}
+	// The table is created by the first migration, rather than here, so
+	// that a dry run leaves the database unchanged.
+	var exists int
+	if err := q.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", m.Table).Scan(&exists); err != nil || exists == 0 {
+		return 0, err
+	}
+	var v sql.NullInt64
+	err := q.QueryRow("SELECT MAX(version) FROM " + script.QuoteIdent(m.Table)).Scan(&v)
+	return int(v.Int64), err
+}
+
+func (m *Migrator) createTable(q queryer) error {
+	_, err := q.Exec("CREATE TABLE IF NOT EXISTS " + script.QuoteIdent(m.Table) +
+		" (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP)")
+	return err
+}
+
+// record stores the new schema version after mig has been applied in
+// direction d.
+func (m *Migrator) record(q queryer, mig Migration, d Direction, prev int) error {
+	if m.Table == "" {
+		version := mig.Version
+		if d == Down {
+			version = prev
+		}
+		_, err := q.Exec(fmt.Sprintf("PRAGMA user_version = %d", version))
+		return err
+	}
+	var err error
+	if d == Up {
+		_, err = q.Exec("INSERT INTO "+script.QuoteIdent(m.Table)+" (version, name) VALUES (?, ?)", mig.Version, mig.Name)
+	} else {
+		_, err = q.Exec("DELETE FROM "+script.QuoteIdent(m.Table)+" WHERE version = ?", mig.Version)
+	}
+	return err
+}
+
+// Plan returns the migrations which must be applied, in direction d, to bring
+// the database from its current version to version target.
+func (m *Migrator) Plan(target int) ([]Migration, Direction, error) {
+	current, err := m.Version()
+	if err != nil {
+		return nil, Up, err
+	}
+	return m.plan(current, target)
+}
+
+func (m *Migrator) plan(current, target int) ([]Migration, Direction, error) {
+	migrations := append([]Migration{}, m.Migrations...)
+	sortMigrations(migrations)
+	for i, mig := range migrations {
+		if mig.Version <= 0 {
+			return nil, Up, fmt.Errorf("migrate: invalid migration version %d", mig.Version)
+		}
+		if mig.Up == nil {
+			return nil, Up, fmt.Errorf("migrate: migration %d has no Up function", mig.Version)
+		}
+		if i > 0 && migrations[i-1].Version == mig.Version {
+			return nil, Up, fmt.Errorf("migrate: duplicate migration version %d", mig.Version)
+		}
+	}
+	var plan []Migration
+	if target >= current {
+		for _, mig := range migrations {
+			if mig.Version > current && mig.Version <= target {
+				plan = append(plan, mig)
+			}
+		}
+		return plan, Up, nil
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		mig := migrations[i]
+		if mig.Version <= current && mig.Version > target {
+			if mig.Down == nil {
+				return nil, Down, fmt.Errorf("%w: %d %s", ErrIrreversible, mig.Version, mig.Name)
+			}
+			plan = append(plan, mig)
+		}
+	}
+	return plan, Down, nil
+}
+
+// Latest returns the highest version among the migrations.
+func (m *Migrator) Latest() int {
+	var latest int
+	for _, mig := range m.Migrations {
+		if mig.Version > latest {
+			latest = mig.Version
+		}
+	}
+	return latest
+}
+
+// Up applies all pending migrations, and returns those which were applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	return m.To(m.Latest())
+}
+
+// Down reverts the most recently applied migration, and returns it.
+func (m *Migrator) Down() ([]Migration, error) {
+	current, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	target := 0
+	for _, mig := range m.Migrations {
+		if mig.Version < current && mig.Version > target {
+			target = mig.Version
+		}
+	}
+	return m.To(target)
+}
+
+// To migrates the database, up or down, to version target, and returns the
+// migrations which were applied or reverted. Each migration is run in its own
+// transaction; if one fails, the migrations before it remain applied.
+func (m *Migrator) To(target int) ([]Migration, error) {
+	current, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	plan, dir, err := m.plan(current, target)
+	if err != nil || len(plan) == 0 {
+		return nil, err
+	}
+	if m.DryRun {
+		return plan, m.dryRun(plan, dir, target)
+	}
+	for i, mig := range plan {
+		if err := m.apply(mig, dir, m.previous(plan, i, target)); err != nil {
+			return plan[:i], err
+		}
+	}
+	return plan, nil
+}
+
+// previous returns the version the database is at after reverting plan[i].
+func (m *Migrator) previous(plan []Migration, i, target int) int {
+	if i+1 < len(plan) {
+		return plan[i+1].Version
+	}
+	return target
+}
+
+func (m *Migrator) apply(mig Migration, dir Direction, prev int) (err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	return m.run(tx, mig, dir, prev)
+}
+
+func (m *Migrator) run(tx *sql.Tx, mig Migration, dir Direction, prev int) error {
+	if m.Log != nil {
+		m.Log(mig, dir)
+	}
+	fn := mig.Up
+	if dir == Down {
+		fn = mig.Down
+	}
+	if m.Table != "" {
+		if err := m.createTable(tx); err != nil {
+			return err
+		}
+	}
+	if err := fn(tx); err != nil {
+		return fmt.Errorf("migrate: %s %d %s: %w", dir, mig.Version, mig.Name, err)
+	}
+	return m.record(tx, mig, dir, prev)
+}
+
+func (m *Migrator) dryRun(plan []Migration, dir Direction, target int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, mig := range plan {
+		if err := m.run(tx, mig, dir, m.previous(plan, i, target)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// +build js
+
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/flimzy/go-sql.js"
+)
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", name).Scan(&n); err != nil {
+		t.Fatalf("Error querying sqlite_master: %s", err)
+	}
+	return n > 0
+}
+
+func TestMigrateUserVersion(t *testing.T) {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+
+	migrations, err := FromFS(os.DirFS("."), "testdata")
+	if err != nil {
+		t.Fatalf("Error reading migrations: %s", err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "create_users" || migrations[1].Down != nil {
+		t.Fatalf("Unexpected migrations: %v", migrations)
+	}
+	migrations = append(migrations, Migration{
+		Version: 3,
+		Name:    "seed",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec("INSERT INTO users (name, email) VALUES (?, ?)", "Bob", "bob@example.com")
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec("DELETE FROM users")
+			return err
+		},
+	})
+	m := &Migrator{DB: db, Migrations: migrations, DryRun: true}
+
+	plan, err := m.Up()
+	if err != nil {
+		t.Fatalf("Error in dry run: %s", err)
+	}
+	if len(plan) != 3 {
+		t.Fatalf("Expected 3 planned migrations, got %d", len(plan))
+	}
+	if v, _ := m.Version(); v != 0 || tableExists(t, db, "users") {
+		t.Fatalf("Dry run modified the database (version %d)", v)
+	}
+
+	m.DryRun = false
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Error migrating: %s", err)
+	}
+	if v, _ := m.Version(); v != 3 {
+		t.Fatalf("Unexpected version after migrating: %d", v)
+	}
+	var email string
+	if err := db.QueryRow("SELECT email FROM users WHERE name='Bob'").Scan(&email); err != nil || email != "bob@example.com" {
+		t.Fatalf("Unexpected email: %s, %v", email, err)
+	}
+	if applied, err := m.Up(); err != nil || len(applied) != 0 {
+		t.Fatalf("Expected no migrations to apply: %v, %v", applied, err)
+	}
+
+	if _, err := m.Down(); err != nil {
+		t.Fatalf("Error reverting: %s", err)
+	}
+	if v, _ := m.Version(); v != 2 {
+		t.Fatalf("Unexpected version after reverting: %d", v)
+	}
+	if _, err := m.To(0); !errors.Is(err, ErrIrreversible) {
+		t.Fatalf("Expected ErrIrreversible, got: %v", err)
+	}
+}
+
+func TestMigrateTable(t *testing.T) {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+
+	m := &Migrator{
+		DB:    db,
+		Table: "schema_migrations",
+		Migrations: []Migration{
+			SQL(2, "bar", "CREATE TABLE bar (x int)", "DROP TABLE bar"),
+			SQL(1, "foo", "CREATE TABLE foo (x int)", "DROP TABLE foo"),
+			SQL(3, "broken", "CREATE TABLE baz (x int); INSERT INTO nonexistent VALUES (1)", ""),
+		},
+		DryRun: true,
+	}
+	if _, err := m.To(2); err != nil {
+		t.Fatalf("Error in dry run: %s", err)
+	}
+	if tableExists(t, db, "schema_migrations") {
+		t.Fatal("Dry run created the migrations table")
+	}
+
+	m.DryRun = false
+	applied, err := m.Up()
+	var sqlErr *sqljs.Error
+	if !errors.As(err, &sqlErr) {
+		t.Fatalf("Expected the broken migration to fail with an *sqljs.Error, got: %v", err)
+	}
+	if len(applied) != 2 || applied[0].Version != 1 {
+		t.Fatalf("Unexpected migrations applied: %v", applied)
+	}
+	if v, _ := m.Version(); v != 2 {
+		t.Fatalf("Unexpected version: %d", v)
+	}
+	if tableExists(t, db, "baz") {
+		t.Fatal("Failed migration was not rolled back")
+	}
+
+	m.Migrations = m.Migrations[:2]
+	if _, err := m.To(0); err != nil {
+		t.Fatalf("Error reverting: %s", err)
+	}
+	if tableExists(t, db, "foo") || tableExists(t, db, "bar") {
+		t.Fatal("Tables not dropped")
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM "schema_migrations"`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("Unexpected migrations recorded: %d, %v", n, err)
+	}
+}
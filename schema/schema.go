@@ -0,0 +1,286 @@
+// Package schema reads the schema of an SQLite database, such as one opened
+// with the sqljs driver, into Go structs.
+//
+// All functions accept a Querier, which is satisfied by *sql.DB and *sql.Tx.
+// To inspect a bindings.Database, wrap it with sqljs.OpenDB().
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Querier executes queries which return rows.
+type Querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Table describes a table.
+type Table struct {
+	Name        string
+	SQL         string
+	Columns     []Column
+	Indexes     []Index
+	ForeignKeys []ForeignKey
+	Triggers    []Trigger
+}
+
+// View describes a view.
+type View struct {
+	Name    string
+	SQL     string
+	Columns []Column
+}
+
+// Column describes a column of a table or view.
+type Column struct {
+	Name string
+	// Type is the declared type, as given in the CREATE TABLE statement.
+	Type    string
+	NotNull bool
+	// Default is the SQL text of the default value, if any.
+	Default sql.NullString
+	// PrimaryKey is the 1-based position of the column within the primary
+	// key, or 0 if the column is not part of the primary key.
+	PrimaryKey int
+}
+
+// Index describes an index.
+type Index struct {
+	Name   string
+	Table  string
+	Unique bool
+	// Origin is "c" for indexes created with CREATE INDEX, "u" for those
+	// created by a UNIQUE constraint, and "pk" for those created by a PRIMARY
+	// KEY constraint.
+	Origin  string
+	Partial bool
+	// Columns are the names of the indexed columns, in order. Expressions
+	// are returned as empty strings.
+	Columns []string
+	// SQL is the CREATE INDEX statement, which is empty for automatically
+	// created indexes.
+	SQL string
+}
+
+// ForeignKey describes a foreign key constraint.
+type ForeignKey struct {
+	ID int
+	// Table is the referenced (parent) table.
+	Table    string
+	From     []string
+	To       []string
+	OnUpdate string
+	OnDelete string
+	Match    string
+}
+
+// Trigger describes a trigger.
+type Trigger struct {
+	Name  string
+	Table string
+	SQL   string
+}
+
+type master struct {
+	name, table, sql string
+}
+
+// objects returns the objects of the given type from sqlite_master,
+// excluding SQLite's internal objects.
+func objects(q Querier, typ string) ([]master, error) {
+	rows, err := q.Query("SELECT name, tbl_name, COALESCE(sql, '') FROM sqlite_master "+
+		"WHERE type = ? AND substr(name, 1, 7) <> 'sqlite_' ORDER BY name", typ)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var objs []master
+	for rows.Next() {
+		var m master
+		if err := rows.Scan(&m.name, &m.table, &m.sql); err != nil {
+			return nil, err
+		}
+		objs = append(objs, m)
+	}
+	return objs, rows.Err()
+}
+
+// Tables returns all tables in the database, with their columns, indexes,
+// foreign keys and triggers.
+func Tables(q Querier) ([]Table, error) {
+	objs, err := objects(q, "table")
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]Table, len(objs))
+	for i, obj := range objs {
+		if err := readTable(q, &tables[i], obj); err != nil {
+			return nil, err
+		}
+	}
+	return tables, nil
+}
+
+// LookupTable returns the named table, or nil if it does not exist.
+func LookupTable(q Querier, name string) (*Table, error) {
+	objs, err := objects(q, "table")
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if obj.name == name {
+			t := &Table{}
+			return t, readTable(q, t, obj)
+		}
+	}
+	return nil, nil
+}
+
+func readTable(q Querier, t *Table, obj master) error {
+	t.Name, t.SQL = obj.name, obj.sql
+	var err error
+	if t.Columns, err = Columns(q, t.Name); err != nil {
+		return err
+	}
+	if t.Indexes, err = Indexes(q, t.Name); err != nil {
+		return err
+	}
+	if t.ForeignKeys, err = ForeignKeys(q, t.Name); err != nil {
+		return err
+	}
+	triggers, err := Triggers(q)
+	if err != nil {
+		return err
+	}
+	for _, trigger := range triggers {
+		if trigger.Table == t.Name {
+			t.Triggers = append(t.Triggers, trigger)
+		}
+	}
+	return nil
+}
+
+// Views returns all views in the database, with their columns.
+func Views(q Querier) ([]View, error) {
+	objs, err := objects(q, "view")
+	if err != nil {
+		return nil, err
+	}
+	views := make([]View, len(objs))
+	for i, obj := range objs {
+		views[i].Name, views[i].SQL = obj.name, obj.sql
+		if views[i].Columns, err = Columns(q, obj.name); err != nil {
+			return nil, err
+		}
+	}
+	return views, nil
+}
+
+// Columns returns the columns of the named table or view.
+func Columns(q Querier, table string) ([]Column, error) {
+	rows, err := q.Query(`SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []Column
+	for rows.Next() {
+		var c Column
+		if err := rows.Scan(&c.Name, &c.Type, &c.NotNull, &c.Default, &c.PrimaryKey); err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if cols == nil {
+		return nil, fmt.Errorf("schema: no such table: %s", table)
+	}
+	return cols, nil
+}
+
+// Indexes returns the indexes of the named table.
+func Indexes(q Querier, table string) ([]Index, error) {
+	rows, err := q.Query(`SELECT l.name, l."unique", l.origin, l.partial, COALESCE(m.sql, '') `+
+		`FROM pragma_index_list(?) AS l LEFT JOIN sqlite_master AS m ON m.type = 'index' AND m.name = l.name `+
+		`ORDER BY l.name`, table)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []Index
+	for rows.Next() {
+		idx := Index{Table: table}
+		if err := rows.Scan(&idx.Name, &idx.Unique, &idx.Origin, &idx.Partial, &idx.SQL); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		indexes = append(indexes, idx)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range indexes {
+		if indexes[i].Columns, err = indexColumns(q, indexes[i].Name); err != nil {
+			return nil, err
+		}
+	}
+	return indexes, nil
+}
+
+func indexColumns(q Querier, index string) ([]string, error) {
+	rows, err := q.Query("SELECT COALESCE(name, '') FROM pragma_index_info(?) ORDER BY seqno", index)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+	}
+	return cols, rows.Err()
+}
+
+// ForeignKeys returns the foreign key constraints of the named table.
+func ForeignKeys(q Querier, table string) ([]ForeignKey, error) {
+	rows, err := q.Query(`SELECT id, "table", "from", COALESCE("to", ''), on_update, on_delete, "match" `+
+		`FROM pragma_foreign_key_list(?) ORDER BY id, seq`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var fks []ForeignKey
+	for rows.Next() {
+		var fk ForeignKey
+		var from, to string
+		if err := rows.Scan(&fk.ID, &fk.Table, &from, &to, &fk.OnUpdate, &fk.OnDelete, &fk.Match); err != nil {
+			return nil, err
+		}
+		if n := len(fks); n == 0 || fks[n-1].ID != fk.ID {
+			fks = append(fks, fk)
+		}
+		last := &fks[len(fks)-1]
+		last.From = append(last.From, from)
+		last.To = append(last.To, to)
+	}
+	return fks, rows.Err()
+}
+
+// Triggers returns all triggers in the database.
+func Triggers(q Querier) ([]Trigger, error) {
+	objs, err := objects(q, "trigger")
+	if err != nil {
+		return nil, err
+	}
+	triggers := make([]Trigger, len(objs))
+	for i, obj := range objs {
+		triggers[i] = Trigger{Name: obj.name, Table: obj.table, SQL: obj.sql}
+	}
+	return triggers, nil
+}
@@ -0,0 +1,85 @@
+// +build js
+
+package schema
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/flimzy/go-sql.js"
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+const testSchema = `
+CREATE TABLE authors (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE);
+CREATE TABLE books (
+	id INTEGER PRIMARY KEY,
+	author_id INTEGER NOT NULL REFERENCES authors (id) ON DELETE CASCADE,
+	title TEXT NOT NULL DEFAULT 'untitled',
+	published DATETIME
+);
+CREATE INDEX books_title ON books (title, published);
+CREATE VIEW book_titles AS SELECT b.title, a.name FROM books b JOIN authors a ON a.id = b.author_id;
+CREATE TRIGGER authors_delete AFTER DELETE ON authors BEGIN SELECT 1; END;
+CREATE TABLE sqlitex (x);
+`
+
+func TestSchema(t *testing.T) {
+	bdb := bindings.New()
+	if err := bdb.Run(testSchema); err != nil {
+		t.Fatalf("Error creating schema: %s", err)
+	}
+	db := sqljs.OpenDB(bdb)
+	defer bdb.Close()
+	defer db.Close()
+
+	tables, err := Tables(db)
+	if err != nil {
+		t.Fatalf("Error reading tables: %s", err)
+	}
+	if len(tables) != 3 || tables[0].Name != "authors" || tables[1].Name != "books" || tables[2].Name != "sqlitex" {
+		t.Fatalf("Unexpected tables: %v", tables)
+	}
+
+	authors := tables[0]
+	if len(authors.Indexes) != 1 || authors.Indexes[0].Origin != "u" || !authors.Indexes[0].Unique {
+		t.Fatalf("Unexpected authors indexes: %v", authors.Indexes)
+	}
+	if len(authors.Triggers) != 1 || authors.Triggers[0].Name != "authors_delete" {
+		t.Fatalf("Unexpected authors triggers: %v", authors.Triggers)
+	}
+
+	books := tables[1]
+	expected := []Column{
+		{Name: "id", Type: "INTEGER", PrimaryKey: 1},
+		{Name: "author_id", Type: "INTEGER", NotNull: true},
+		{Name: "title", Type: "TEXT", NotNull: true, Default: sql.NullString{String: "'untitled'", Valid: true}},
+		{Name: "published", Type: "DATETIME"},
+	}
+	if !reflect.DeepEqual(books.Columns, expected) {
+		t.Fatalf("Unexpected books columns: %+v", books.Columns)
+	}
+	if len(books.Indexes) != 1 || !reflect.DeepEqual(books.Indexes[0].Columns, []string{"title", "published"}) || books.Indexes[0].SQL == "" {
+		t.Fatalf("Unexpected books indexes: %+v", books.Indexes)
+	}
+	fk := ForeignKey{Table: "authors", From: []string{"author_id"}, To: []string{"id"}, OnUpdate: "NO ACTION", OnDelete: "CASCADE", Match: "NONE"}
+	if !reflect.DeepEqual(books.ForeignKeys, []ForeignKey{fk}) {
+		t.Fatalf("Unexpected books foreign keys: %+v", books.ForeignKeys)
+	}
+
+	views, err := Views(db)
+	if err != nil {
+		t.Fatalf("Error reading views: %s", err)
+	}
+	if len(views) != 1 || len(views[0].Columns) != 2 || views[0].Columns[1].Name != "name" {
+		t.Fatalf("Unexpected views: %+v", views)
+	}
+
+	if table, err := LookupTable(db, "nonexistent"); err != nil || table != nil {
+		t.Fatalf("Unexpected result for nonexistent table: %v, %v", table, err)
+	}
+	if _, err := Columns(db, "nonexistent"); err == nil {
+		t.Fatal("Expected an error for nonexistent table")
+	}
+}
@@ -0,0 +1,65 @@
+package script
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuoteIdent quotes name for use as an SQL identifier, such as a table or
+// column name.
+func QuoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// Literal formats v as an SQL literal. Integers of any size are written as
+// integers, and floats as reals: infinite floats are written as 1e999 and
+// -1e999, which SQLite reads back as infinities, and NaN as NULL, as SQLite
+// stores it. Times are written as RFC 3339 text, as they are bound. Values of
+// other types are formatted as strings.
+func Literal(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "NULL"
+	case time.Time:
+		return Literal(t.Format(time.RFC3339Nano))
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		switch {
+		case math.IsInf(f, 1):
+			return "1e999"
+		case math.IsInf(f, -1):
+			return "-1e999"
+		case math.IsNaN(f):
+			return "NULL"
+		}
+		s := strconv.FormatFloat(f, 'g', -1, rv.Type().Bits())
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return "X'" + hex.EncodeToString(rv.Bytes()) + "'"
+		}
+	case reflect.String:
+		return "'" + strings.Replace(rv.String(), "'", "''", -1) + "'"
+	case reflect.Bool:
+		if rv.Bool() {
+			return "1"
+		}
+		return "0"
+	}
+	return Literal(fmt.Sprint(v))
+}
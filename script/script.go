@@ -0,0 +1,323 @@
+// Package script tokenizes SQLite SQL text, splits scripts into individual
+// statements, and quotes identifiers and values for use in SQL text.
+//
+// Statement boundaries are determined the same way as by SQLite's
+// sqlite3_complete(): semicolons inside string literals, quoted identifiers,
+// comments and the bodies of CREATE TRIGGER statements do not end a
+// statement.
+package script
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Statement is a single statement read from a script.
+type Statement struct {
+	// SQL is the text of the statement, including its terminating
+	// semicolon, if any. Leading whitespace and comments are removed.
+	SQL string
+	// Offset is the byte offset of the start of the statement within the
+	// script.
+	Offset int64
+	// Line is the 1-based line number of the start of the statement.
+	Line int
+}
+
+// Token types, as used by sqlite3_complete().
+const (
+	tkSemi = iota
+	tkWS
+	tkOther
+	tkExplain
+	tkCreate
+	tkTemp
+	tkTrigger
+	tkEnd
+)
+
+// States of the sqlite3_complete() state machine.
+const (
+	stInvalid = iota
+	stStart
+	stNormal
+	stExplain
+	stCreate
+	stTrigger
+	stSemi
+	stEnd
+)
+
+// trans is the state transition table of sqlite3_complete(), indexed by
+// state and token type.
+var trans = [8][8]int{
+	//              SEMI     WS         OTHER      EXPLAIN    CREATE    TEMP       TRIGGER    END
+	stInvalid: {stStart, stInvalid, stNormal, stExplain, stCreate, stNormal, stNormal, stNormal},
+	stStart:   {stStart, stStart, stNormal, stExplain, stCreate, stNormal, stNormal, stNormal},
+	stNormal:  {stStart, stNormal, stNormal, stNormal, stNormal, stNormal, stNormal, stNormal},
+	stExplain: {stStart, stExplain, stExplain, stNormal, stCreate, stNormal, stNormal, stNormal},
+	stCreate:  {stStart, stCreate, stNormal, stNormal, stNormal, stCreate, stTrigger, stNormal},
+	stTrigger: {stSemi, stTrigger, stTrigger, stTrigger, stTrigger, stTrigger, stTrigger, stTrigger},
+	stSemi:    {stSemi, stSemi, stTrigger, stTrigger, stTrigger, stTrigger, stTrigger, stEnd},
+	stEnd:     {stStart, stEnd, stTrigger, stTrigger, stTrigger, stTrigger, stTrigger, stTrigger},
+}
+
+var keywords = map[string]int{
+	"EXPLAIN":   tkExplain,
+	"CREATE":    tkCreate,
+	"TEMP":      tkTemp,
+	"TEMPORARY": tkTemp,
+	"TRIGGER":   tkTrigger,
+	"END":       tkEnd,
+}
+
+// Complete returns true if sql ends with a complete SQL statement, that is,
+// with a semicolon which is not part of a string literal, quoted identifier,
+// comment or trigger body. It is equivalent to sqlite3_complete().
+func Complete(sql string) bool {
+	s := NewSplitter(strings.NewReader(sql))
+	state := stInvalid
+	for {
+		tk, _, err := s.token()
+		if err != nil {
+			return state == stStart
+		}
+		state = trans[state][tk]
+	}
+}
+
+// Split splits sql into its statements.
+func Split(sql string) ([]Statement, error) {
+	s := NewSplitter(strings.NewReader(sql))
+	var stmts []Statement
+	for {
+		stmt, err := s.Next()
+		if err == io.EOF {
+			return stmts, nil
+		}
+		if err != nil {
+			return stmts, err
+		}
+		stmts = append(stmts, *stmt)
+	}
+}
+
+// Splitter reads statements from a script one at a time, so that arbitrarily
+// large scripts need not be held in memory.
+type Splitter struct {
+	r      *bufio.Reader
+	offset int64 // Bytes consumed
+	line   int   // Current line
+	buf    bytes.Buffer
+}
+
+// NewSplitter returns a Splitter which reads from r.
+func NewSplitter(r io.Reader) *Splitter {
+	return &Splitter{r: bufio.NewReader(r), line: 1}
+}
+
+// Offset returns the number of bytes of the script consumed so far.
+func (s *Splitter) Offset() int64 {
+	return s.offset
+}
+
+// Next returns the next statement, or io.EOF when the script is exhausted. A
+// final statement without a terminating semicolon is returned as-is.
+// Statements consisting only of whitespace, comments and semicolons are
+// skipped.
+func (s *Splitter) Next() (*Statement, error) {
+	var stmt *Statement
+	state := stInvalid
+	hasTokens := false
+	for {
+		start, line := s.offset, s.line
+		tk, text, err := s.token()
+		if err == io.EOF {
+			if hasTokens {
+				stmt.SQL = strings.TrimRight(stmt.SQL+s.flush(), spaces)
+				return stmt, nil
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if stmt == nil && tk != tkWS {
+			stmt = &Statement{Offset: start, Line: line}
+		}
+		if stmt != nil {
+			s.buf.WriteString(text)
+		}
+		state = trans[state][tk]
+		switch {
+		case tk != tkWS && tk != tkSemi:
+			hasTokens = true
+		case state == stStart && hasTokens:
+			stmt.SQL = s.flush()
+			return stmt, nil
+		case state == stStart:
+			// An empty statement
+			stmt = nil
+			s.buf.Reset()
+		}
+	}
+}
+
+func (s *Splitter) flush() string {
+	text := s.buf.String()
+	s.buf.Reset()
+	return text
+}
+
+// read reads the next byte of the script. The tokenizer works on bytes rather
+// than runes, as only ASCII characters are significant, so that text which is
+// not valid UTF-8, such as a string literal in another encoding, is passed
+// through unchanged.
+func (s *Splitter) read() (byte, error) {
+	c, err := s.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	s.offset++
+	if c == '\n' {
+		s.line++
+	}
+	return c, nil
+}
+
+func (s *Splitter) peek() byte {
+	b, err := s.r.Peek(1)
+	if err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+// spaces are the whitespace characters recognized by SQLite.
+const spaces = " \t\n\v\f\r"
+
+// token reads the next token, returning its type and text. Comments are
+// returned as whitespace. An unterminated string, identifier or comment
+// extends to the end of the input.
+func (s *Splitter) token() (int, string, error) {
+	c, err := s.read()
+	if err != nil {
+		return 0, "", err
+	}
+	var text strings.Builder
+	text.WriteByte(c)
+	switch {
+	case c == ';':
+		return tkSemi, ";", nil
+	case strings.IndexByte(spaces, c) >= 0:
+		return tkWS, text.String(), nil
+	case c == '-' && s.peek() == '-':
+		for {
+			c, err := s.read()
+			if err != nil {
+				break
+			}
+			text.WriteByte(c)
+			if c == '\n' {
+				break
+			}
+		}
+		return tkWS, text.String(), nil
+	case c == '/' && s.peek() == '*':
+		// Skip the opener's '*', so that it cannot also close the comment,
+		// as in "/*/".
+		c, _ = s.read()
+		text.WriteByte(c)
+		prev := byte(0)
+		for {
+			c, err := s.read()
+			if err != nil {
+				break
+			}
+			text.WriteByte(c)
+			if c == '/' && prev == '*' {
+				break
+			}
+			prev = c
+		}
+		return tkWS, text.String(), nil
+	case c == '\'' || c == '"' || c == '`' || c == '[':
+		end := c
+		if c == '[' {
+			end = ']'
+		}
+		for {
+			c, err := s.read()
+			if err != nil {
+				break
+			}
+			text.WriteByte(c)
+			if c == end {
+				if end == ']' || s.peek() != end {
+					break
+				}
+				c, _ = s.read()
+				text.WriteByte(c)
+			}
+		}
+		return tkOther, text.String(), nil
+	case isIdent(c):
+		for isIdent(s.peek()) {
+			c, _ := s.read()
+			text.WriteByte(c)
+		}
+		if tk, ok := keywords[strings.ToUpper(text.String())]; ok {
+			return tk, text.String(), nil
+		}
+		return tkOther, text.String(), nil
+	}
+	return tkOther, text.String(), nil
+}
+
+// isIdent reports whether c may be part of an identifier. As in SQLite, every
+// byte of a multi-byte UTF-8 sequence is.
+func isIdent(c byte) bool {
+	return c == '_' || c == '$' || c > 0x7f || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// Keyword returns the first keyword of the statement sql, in upper case,
+// skipping leading whitespace and comments. For a statement which begins with
+// common table expressions (WITH ...), the keyword of the statement which
+// follows them, such as SELECT or DELETE, is returned. An empty string is
+// returned if sql does not begin with a keyword.
+func Keyword(sql string) string {
+	s := NewSplitter(strings.NewReader(sql))
+	with, depth := false, 0
+	for {
+		tk, text, err := s.token()
+		if err != nil || tk == tkSemi {
+			return ""
+		}
+		if tk == tkWS {
+			continue
+		}
+		word := strings.ToUpper(text)
+		if !with {
+			if !isIdent(text[0]) {
+				return ""
+			}
+			if word != "WITH" {
+				return word
+			}
+			with = true
+			continue
+		}
+		switch word {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case "SELECT", "VALUES", "INSERT", "REPLACE", "UPDATE", "DELETE":
+			if depth == 0 {
+				return word
+			}
+		}
+	}
+}
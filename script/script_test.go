@@ -0,0 +1,170 @@
+package script
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComplete(t *testing.T) {
+	tests := map[string]bool{
+		"":                     false,
+		"SELECT 1":             false,
+		"SELECT 1;":            true,
+		"SELECT 1; -- comment": true,
+		"SELECT ';":            false,
+		"SELECT 1 /* ; */":     false,
+		"/*/ ; */ SELECT 1":    false,
+		"SELECT \"a;b\";":      true,
+		"SELECT [a;b], `c;d`;": true,
+		"CREATE TRIGGER t AFTER INSERT ON x BEGIN SELECT 1;":              false,
+		"CREATE TRIGGER t AFTER INSERT ON x BEGIN SELECT 1; END;":         true,
+		"CREATE TEMP TRIGGER t AFTER INSERT ON x BEGIN SELECT 1; END":     false,
+		"EXPLAIN CREATE TRIGGER t AFTER INSERT ON x BEGIN SELECT 1; end;": true,
+		"CREATE TABLE trigger (x);":                                       true,
+	}
+	for sql, expected := range tests {
+		if result := Complete(sql); result != expected {
+			t.Errorf("Complete(%q) = %t, expected %t", sql, result, expected)
+		}
+	}
+}
+
+func TestKeyword(t *testing.T) {
+	tests := map[string]string{
+		"":                                   "",
+		"select 1":                           "SELECT",
+		"-- comment\n /* c */ Insert INTO t": "INSERT",
+		"WITH x AS (SELECT 1) DELETE FROM t": "DELETE",
+		"WITH RECURSIVE x(n) AS (VALUES (1) UNION ALL SELECT n+1 FROM x) SELECT * FROM x": "SELECT",
+		"explain delete from t": "EXPLAIN",
+		"'text'":                "",
+		";SELECT 1":             "",
+	}
+	for sql, expected := range tests {
+		if result := Keyword(sql); result != expected {
+			t.Errorf("Keyword(%q) = %q, expected %q", sql, result, expected)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	script := `-- Schema
+CREATE TABLE foo (x TEXT); ;
+INSERT INTO foo VALUES ('a;b'), ('it''s');
+
+/* trigger; with semicolons */
+CREATE TRIGGER foo_insert AFTER INSERT ON foo
+BEGIN
+	INSERT INTO bar VALUES (new.x);
+	SELECT "end;";
+END;
+SELECT 1 -- no semicolon
+`
+	stmts, err := Split(script)
+	if err != nil {
+		t.Fatalf("Error splitting: %s", err)
+	}
+	expected := []Statement{
+		{SQL: "CREATE TABLE foo (x TEXT);", Offset: 10, Line: 2},
+		{SQL: "INSERT INTO foo VALUES ('a;b'), ('it''s');", Offset: 39, Line: 3},
+		{SQL: "CREATE TRIGGER foo_insert AFTER INSERT ON foo\nBEGIN\n\tINSERT INTO bar VALUES (new.x);\n\tSELECT \"end;\";\nEND;", Offset: 114, Line: 6},
+		{SQL: "SELECT 1 -- no semicolon", Offset: 220, Line: 11},
+	}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Fatalf("Unexpected statements:\n%#v\nexpected:\n%#v", stmts, expected)
+	}
+	for _, stmt := range expected {
+		if !strings.HasPrefix(script[stmt.Offset:], stmt.SQL) {
+			t.Errorf("Offset %d does not point at %q", stmt.Offset, stmt.SQL)
+		}
+	}
+}
+
+func TestSplitCommentOpener(t *testing.T) {
+	stmts, err := Split("/*/ ; */ SELECT 1; SELECT 2;")
+	if err != nil {
+		t.Fatalf("Error splitting: %s", err)
+	}
+	expected := []Statement{
+		{SQL: "SELECT 1;", Offset: 9, Line: 1},
+		{SQL: "SELECT 2;", Offset: 19, Line: 1},
+	}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Fatalf("Unexpected statements:\n%#v\nexpected:\n%#v", stmts, expected)
+	}
+}
+
+func TestSplitInvalidUTF8(t *testing.T) {
+	script := "INSERT INTO foo VALUES ('caf\xe9;'); SELECT 'x\xff\xfe';"
+	stmts, err := Split(script)
+	if err != nil {
+		t.Fatalf("Error splitting: %s", err)
+	}
+	expected := []Statement{
+		{SQL: "INSERT INTO foo VALUES ('caf\xe9;');", Offset: 0, Line: 1},
+		{SQL: "SELECT 'x\xff\xfe';", Offset: 34, Line: 1},
+	}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Fatalf("Unexpected statements:\n%#v\nexpected:\n%#v", stmts, expected)
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "NULL"},
+		{int64(-3), "-3"},
+		{2.0, "2.0"},
+		{math.Inf(-1), "-1e999"},
+		{[]byte{0, 0xff}, "X'00ff'"},
+		{"it's", "'it''s'"},
+		{true, "1"},
+		{5, "5"},
+		{int8(-8), "-8"},
+		{int16(16), "16"},
+		{int32(-32), "-32"},
+		{uint(7), "7"},
+		{uint8(1), "1"},
+		{uint16(16), "16"},
+		{uint32(32), "32"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{float32(1.5), "1.5"},
+		{float32(0.1), "0.1"},
+		{float32(2), "2.0"},
+		{float32(math.Inf(1)), "1e999"},
+		{time.Date(2021, 6, 1, 12, 30, 0, 500000000, time.UTC), "'2021-06-01T12:30:00.5Z'"},
+		{time.Date(2021, 6, 1, 12, 30, 0, 0, time.FixedZone("", 2*3600)), "'2021-06-01T12:30:00+02:00'"},
+	}
+	for _, test := range tests {
+		if result := Literal(test.value); result != test.expected {
+			t.Errorf("Literal(%#v) = %s, expected %s", test.value, result, test.expected)
+		}
+	}
+	if result := QuoteIdent(`a "b"`); result != `"a ""b"""` {
+		t.Errorf("Unexpected quoted identifier: %s", result)
+	}
+}
+
+func TestIsShadowTable(t *testing.T) {
+	tests := []struct {
+		table, vtable string
+		expected      bool
+	}{
+		{"docs_fts_data", "docs_fts", true},
+		{"Docs_FTS_content", "docs_fts", true},
+		{"docs_fts_segdir", "docs_fts", true},
+		{"docs_fts_archive", "docs_fts", false},
+		{"docs_fts", "docs_fts", false},
+		{"docs_data", "docs_fts", false},
+	}
+	for _, test := range tests {
+		if result := IsShadowTable(test.table, test.vtable); result != test.expected {
+			t.Errorf("IsShadowTable(%q, %q) = %t, expected %t", test.table, test.vtable, result, test.expected)
+		}
+	}
+}
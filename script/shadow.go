@@ -0,0 +1,35 @@
+package script
+
+import "strings"
+
+// shadowSuffixes are the suffixes of the names of the shadow tables created
+// by the FTS3, FTS4, FTS5 and R*Tree modules.
+var shadowSuffixes = map[string]bool{
+	"content":  true,
+	"segments": true,
+	"segdir":   true,
+	"docsize":  true,
+	"stat":     true,
+	"data":     true,
+	"idx":      true,
+	"config":   true,
+	"node":     true,
+	"rowid":    true,
+	"parent":   true,
+}
+
+// IsShadowTable reports whether table is a shadow table of the virtual table
+// named vtable, in which the FTS3, FTS4, FTS5 or R*Tree module stores its
+// data. Shadow tables are created along with their virtual table, so they
+// must not be created again when the virtual table is copied.
+func IsShadowTable(table, vtable string) bool {
+	prefix := vtable + "_"
+	return len(table) > len(prefix) && strings.EqualFold(table[:len(prefix)], prefix) &&
+		shadowSuffixes[strings.ToLower(table[len(prefix):])]
+}
+
+// IsVirtualTable reports whether sql, as stored in sqlite_master, creates a
+// virtual table.
+func IsVirtualTable(sql string) bool {
+	return len(sql) >= 20 && strings.EqualFold(sql[:20], "CREATE VIRTUAL TABLE")
+}
@@ -1,31 +1,31 @@
-// +build js
-
 // Package sqljs provides a database/sql-compatible interface to SQL.js (https://github.com/lovasoa/sql.js) for GopherJS.
 //
 // SQL.js does not provide anything like a complete SQLite3 API, and this module even less so. This module exists
 // for one primary purpose: To be able to read SQLite3 databases from within a browser. For such purposes, only
 // a small subset of features is considered useful.  To this end, this module is tested only for reading
 // databases. Although writes are supported, there is currently no way to export the database using this
-// package. Also, transactions are not supported.
+// package.
+//
+// The driver reaches the database through the Backend interface. GopherJS builds use SQL.js by default, while
+// other builds use NativeBackend, which delegates to a native SQLite driver, so that applications using this
+// driver can be built and tested with the standard Go toolchain.
 package sqljs
 
 import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 
 	"database/sql"
 	"database/sql/driver"
-
-	"github.com/flimzy/go-sql.js/bindings"
 )
 
 var readers map[string]io.Reader
 
-// Driver struct. To load an existing database, you must register a new instance
-// of this driver, with an io.Reader pointing to the SQLite3 database file.  See
-// Open() for an example.
-type SQLJSDriver struct{}
+// ErrReadOnly is returned when preparing a statement which would modify the
+// database on a read-only connection.
+var ErrReadOnly = errors.New("statement is not read-only")
 
 func init() {
 	sql.Register("sqljs", &SQLJSDriver{})
@@ -42,77 +42,199 @@ func AddReader(name string, reader io.Reader) error {
 	return nil
 }
 
-// Open will a new database instance. By default, it will create a new database
-// in memory. To open an existing database, you must first register a new
-// instance as the driver. The DSN string is always ignored.
-//
-// Example:
-//
-//    driver := &sqljs.SQLJSDriver{}
-//    sql.Register("sqljs-reader", driver)
-//    file, _ := os.Open("/path/to/database.db")
-//    driver.Reader, _ = file
-//    db := sql.Open("sqljs-reader","")
-func (d *SQLJSDriver) Open(dsn string) (driver.Conn, error) {
-	var db *bindings.Database
-	if dsn == "" {
-		db = bindings.New()
-	} else {
+// openBackend opens the database named by dsn with the driver's backend. An
+// empty dsn opens a new database in memory; any other dsn must have been
+// registered with AddReader().
+func (d *SQLJSDriver) openBackend(dsn string) (BackendDatabase, error) {
+	var r io.Reader
+	if dsn != "" {
 		reader, ok := readers[dsn]
 		if !ok {
 			return nil, fmt.Errorf("reader `%s` does not exist; all AddReader() first", reader)
 		}
 		delete(readers, dsn)
-		db = bindings.OpenReader(reader)
+		r = reader
+	}
+	backend := d.Backend
+	if backend == nil {
+		backend = defaultBackend
+	}
+	return backend.Open(r)
+}
+
+func (d *SQLJSDriver) newConn(db BackendDatabase) *SQLJSConn {
+	conn := &SQLJSConn{db: db, readOnly: d.ReadOnly, trace: d.Trace}
+	switch size := d.StatementCacheSize; {
+	case size == 0:
+		conn.cache = newStmtCache(db, DefaultStatementCacheSize)
+	case size > 0:
+		conn.cache = newStmtCache(db, size)
 	}
-	return &SQLJSConn{db}, nil
+	return conn
 }
 
 // Connection struct
 type SQLJSConn struct {
-	*bindings.Database
+	db       BackendDatabase
+	readOnly bool
+	trace    func(string)
+	cache    *stmtCache
+	borrowed bool // The database belongs to the caller of OpenDB()
 }
 
-// Prepare the query string. Return a new statement handle.
+// Backend returns the backend database of the connection. It may be reached
+// through sql.Conn.Raw().
+func (c *SQLJSConn) Backend() BackendDatabase {
+	return c.db
+}
+
+// CacheStats returns the statistics of the connection's prepared statement
+// cache. It may be reached through sql.Conn.Raw().
+func (c *SQLJSConn) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.statistics()
+}
+
+// Prepare the query string. Return a new statement handle. Statements are
+// served from the connection's statement cache when possible.
 func (c *SQLJSConn) Prepare(query string) (driver.Stmt, error) {
-	s, err := c.Database.Prepare(query)
-	return &SQLJSStmt{s, c.Database}, err
+	var version int64
+	if c.cache != nil {
+		s := c.cache.get(query)
+		version = c.cache.schemaVersion
+		if s != nil {
+			return &SQLJSStmt{stmt: s, conn: c, query: query, schemaVersion: version}, nil
+		}
+	}
+	s, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if c.readOnly {
+		ro, err := isReadOnly(s)
+		if err != nil || !ro {
+			s.Free()
+			if err == nil {
+				err = ErrReadOnly
+			}
+			return nil, err
+		}
+	}
+	return &SQLJSStmt{stmt: s, conn: c, query: query, schemaVersion: version}, nil
 }
 
-// Begin a transaction -- not supported (will always return an error)
+// Begin a transaction.
 func (c *SQLJSConn) Begin() (driver.Tx, error) {
-	return nil, errors.New("Transactions not supported")
+	if err := c.db.Run("BEGIN"); err != nil {
+		return nil, err
+	}
+	return &SQLJSTx{c}, nil
+}
+
+// Exec executes a query without placeholder parameters directly, which allows
+// scripts of several statements, separated by ';', to be executed at once.
+// Queries with parameters, and all queries on read-only connections, are
+// prepared as usual.
+func (c *SQLJSConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	if len(args) > 0 || c.readOnly {
+		return nil, driver.ErrSkip
+	}
+	if c.trace != nil {
+		c.trace(query)
+	}
+	if err := c.db.Run(query); err != nil {
+		return nil, err
+	}
+	return &SQLJSResult{c.db.RowsModified()}, nil
+}
+
+// Transaction struct.
+type SQLJSTx struct {
+	conn *SQLJSConn
+}
+
+// Commit the transaction.
+func (t *SQLJSTx) Commit() error {
+	return t.conn.db.Run("COMMIT")
+}
+
+// Rollback the transaction.
+func (t *SQLJSTx) Rollback() error {
+	return t.conn.db.Run("ROLLBACK")
 }
 
 // Close the database and free memory.
 func (c *SQLJSConn) Close() error {
-	return c.Database.Close()
+	if c.cache != nil {
+		c.cache.close()
+	}
+	if c.borrowed {
+		return nil
+	}
+	return c.db.Close()
 }
 
 // Statement struct.
 type SQLJSStmt struct {
-	*bindings.Statement
-	db *bindings.Database // So we can call GetRowsModified()
+	stmt  BackendStatement
+	conn  *SQLJSConn // So we can call RowsModified()
+	query string
+	// schemaVersion is the schema version of the database when the
+	// statement was prepared, as seen by the connection's statement cache.
+	schemaVersion int64
 }
 
-// Close the statement handler.
+// Close the statement handler. If the connection has a statement cache, the
+// statement is returned to it rather than freed.
 func (s *SQLJSStmt) Close() error {
-	if s.Free() {
-		return nil
+	if s.conn.cache != nil {
+		return s.conn.cache.put(s.query, s.stmt, s.schemaVersion)
 	}
-	return errors.New("Error freeing statement memory")
+	return s.stmt.Free()
 }
 
-// NumInput is unsupported. It will always return -1.
+// NumInput returns the number of placeholder parameters, or -1 if it cannot
+// be determined.
 func (s *SQLJSStmt) NumInput() int {
-	return -1
+	p, ok := s.stmt.(interface {
+		ParameterNames() ([]string, error)
+	})
+	if !ok {
+		return -1
+	}
+	names, err := p.ParameterNames()
+	if err != nil {
+		return -1
+	}
+	return len(names)
+}
+
+// traceQuery passes the expanded SQL of the statement, with its parameters
+// bound, to the driver's Trace function.
+func (s *SQLJSStmt) traceQuery() {
+	if s.conn.trace == nil {
+		return
+	}
+	query, err := expandedSQL(s.stmt)
+	if err != nil {
+		query = s.query
+	}
+	s.conn.trace(query)
 }
 
 // Exec executes a query that does not return any rows.
 func (s *SQLJSStmt) Exec(args []driver.Value) (r driver.Result, e error) {
-	err := s.RunParams(valuesToInterface(args))
+	if s.conn.trace != nil {
+		if err := s.stmt.Bind(valuesToInterface(args)); err != nil {
+			return nil, err
+		}
+		s.traceQuery()
+	}
+	err := s.stmt.Exec(valuesToInterface(args))
 	return &SQLJSResult{
-		s.db.GetRowsModified(),
+		s.conn.db.RowsModified(),
 	}, err
 }
 
@@ -141,51 +263,36 @@ func valuesToInterface(args []driver.Value) []interface{} {
 
 // Query executes a query that may return rows, such as a SELECT.
 func (s *SQLJSStmt) Query(args []driver.Value) (r driver.Rows, e error) {
-	if err := s.Bind(valuesToInterface(args)); err != nil {
+	if err := s.stmt.Bind(valuesToInterface(args)); err != nil {
 		return nil, err
 	}
-	return &SQLJSRows{s.Statement, nil, []string{}, nil}, nil
+	s.traceQuery()
+	return &SQLJSRows{stmt: s.stmt}, nil
 }
 
 // Rows struct.
 type SQLJSRows struct {
-	*bindings.Statement
-	prevStep *prevStep
-	cols     []string
-	err      error
-}
-
-type prevStep struct {
-	ok  bool
-	err error
-}
-
-func (r *SQLJSRows) step() (bool, error) {
-	if r.prevStep == nil {
-		ok, err := r.Step()
-		r.prevStep = &prevStep{ok, err}
-	}
-	return r.prevStep.ok, r.prevStep.err
+	stmt      BackendStatement
+	cols      []string
+	declTypes []string
+	err       error
 }
 
 // Close closes the Rows iterator.
 func (r *SQLJSRows) Close() error {
-	r.Reset()
-	return nil
+	return r.stmt.Reset()
 }
 
+// setColumns reads the column names, which are known as soon as the statement
+// is prepared, so that they are available even when there are no rows.
 func (r *SQLJSRows) setColumns() {
-	if len(r.cols) > 0 {
+	if r.cols != nil {
 		return
 	}
-	if ok, err := r.step(); err != nil {
-		r.err = err
-		return
-	} else if !ok {
-		r.err = errors.New("cannot read column names; nothing to fetch")
-		return
+	cols, err := r.stmt.ColumnNames()
+	if cols == nil {
+		cols = []string{}
 	}
-	cols, err := r.GetColumnNames()
 	r.cols = cols
 	r.err = err
 }
@@ -196,22 +303,37 @@ func (r *SQLJSRows) Columns() []string {
 	return r.cols
 }
 
+// ColumnTypeDatabaseTypeName returns the declared type of the column, as given
+// in the CREATE TABLE statement, in upper case. Columns without a declared
+// type return an empty string.
+func (r *SQLJSRows) ColumnTypeDatabaseTypeName(index int) string {
+	if r.declTypes == nil {
+		types, err := columnDeclTypes(r.stmt)
+		if err != nil {
+			return ""
+		}
+		r.declTypes = types
+	}
+	if index >= len(r.declTypes) {
+		return ""
+	}
+	return strings.ToUpper(r.declTypes[index])
+}
+
 // Next is called to populate the next row of data into the provided slice.
 func (r *SQLJSRows) Next(dest []driver.Value) error {
 	if err := r.err; err != nil {
 		r.err = nil
 		return err
 	}
-	r.setColumns()
-	ok, err := r.step()
-	r.prevStep = nil
+	ok, err := r.stmt.Step()
 	if err != nil {
 		return err
 	}
 	if !ok {
 		return io.EOF
 	}
-	result, err := r.Get()
+	result, err := r.stmt.Get()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,130 @@
+package syncer
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+)
+
+// DefaultPullLimit is the maximum number of changes returned by a pull
+// request which does not specify a limit.
+const DefaultPullLimit = 1000
+
+// Server is a reference implementation of the server side of the protocol,
+// which keeps changes in memory. It handles requests to any URL ending in
+// /pull or /push, so it may be mounted under any prefix. The zero value is
+// ready to use.
+type Server struct {
+	mu      sync.Mutex
+	changes []Change
+}
+
+// Changes returns the changes pushed to the server since seq.
+func (s *Server) Changes(since int64) []Change {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if since < 0 {
+		since = 0
+	}
+	if since >= int64(len(s.changes)) {
+		return nil
+	}
+	return append([]Change{}, s.changes[since:]...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path.Base(r.URL.Path) {
+	case "pull":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.pull(w, r)
+	case "push":
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.push(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) pull(w http.ResponseWriter, r *http.Request) {
+	since, err := queryInt(r, "since", 0)
+	if err != nil || since < 0 {
+		writeError(w, http.StatusBadRequest, "invalid since")
+		return
+	}
+	limit, err := queryInt(r, "limit", DefaultPullLimit)
+	if err != nil || limit <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := pullResponse{Changes: []Change{}, Seq: since}
+	if since < int64(len(s.changes)) {
+		end := since + limit
+		if end > int64(len(s.changes)) {
+			end = int64(len(s.changes))
+		}
+		resp.Changes = s.changes[since:end]
+		resp.Seq = end
+		resp.More = end < int64(len(s.changes))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) push(w http.ResponseWriter, r *http.Request) {
+	var req pushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	for _, c := range req.Changes {
+		if c.Table == "" || len(c.Key) == 0 {
+			writeError(w, http.StatusBadRequest, "change without table or key")
+			return
+		}
+		switch c.Op {
+		case "INSERT", "UPDATE", "DELETE":
+		default:
+			writeError(w, http.StatusBadRequest, "invalid op: "+string(c.Op))
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Since != int64(len(s.changes)) {
+		writeError(w, http.StatusConflict, "changes must be pulled before pushing")
+		return
+	}
+	for _, c := range req.Changes {
+		c.Seq = int64(len(s.changes)) + 1
+		c.Client = req.Client
+		s.changes = append(s.changes, c)
+	}
+	writeJSON(w, http.StatusOK, pushResponse{Seq: int64(len(s.changes))})
+}
+
+func queryInt(r *http.Request, name string, def int64) (int64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
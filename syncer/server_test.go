@@ -0,0 +1,72 @@
+package syncer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	srv := httptest.NewServer(&Server{})
+	defer srv.Close()
+
+	post := func(body string) (int, map[string]interface{}) {
+		resp, err := http.Post(srv.URL+"/sync/push", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error pushing: %s", err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("Error decoding response: %s", err)
+		}
+		return resp.StatusCode, result
+	}
+	get := func(query string) (int, pullResponse) {
+		resp, err := http.Get(srv.URL + "/sync/pull?" + query)
+		if err != nil {
+			t.Fatalf("Error pulling: %s", err)
+		}
+		defer resp.Body.Close()
+		var result pullResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("Error decoding response: %s", err)
+		}
+		return resp.StatusCode, result
+	}
+
+	status, result := post(`{"client": "a", "since": 0, "changes": [
+		{"table": "todos", "op": "INSERT", "key": [1], "new": {"id": 1}, "time": "2021-06-01T12:00:00Z"},
+		{"table": "todos", "op": "INSERT", "key": [2], "new": {"id": 2}, "time": "2021-06-01T12:00:01Z"}
+	]}`)
+	if status != http.StatusOK || result["seq"] != 2.0 {
+		t.Fatalf("Unexpected push response: %d %v", status, result)
+	}
+	if status, result = post(`{"client": "b", "since": 1, "changes": []}`); status != http.StatusConflict {
+		t.Errorf("Expected conflict, got %d %v", status, result)
+	}
+	if status, result = post(`{"client": "b", "since": 2, "changes": [{"table": "todos", "op": "MERGE", "key": [1]}]}`); status != http.StatusBadRequest {
+		t.Errorf("Expected bad request, got %d %v", status, result)
+	}
+
+	status, pulled := get("since=0&limit=1")
+	if status != http.StatusOK || len(pulled.Changes) != 1 || pulled.Seq != 1 || !pulled.More {
+		t.Fatalf("Unexpected pull response: %d %+v", status, pulled)
+	}
+	if c := pulled.Changes[0]; c.Seq != 1 || c.Client != "a" || string(c.Key) != "[1]" {
+		t.Errorf("Unexpected change: %+v", c)
+	}
+	status, pulled = get("since=1")
+	if status != http.StatusOK || len(pulled.Changes) != 1 || pulled.Seq != 2 || pulled.More {
+		t.Fatalf("Unexpected pull response: %d %+v", status, pulled)
+	}
+	status, pulled = get("since=2")
+	if status != http.StatusOK || len(pulled.Changes) != 0 || pulled.Seq != 2 {
+		t.Fatalf("Unexpected pull response: %d %+v", status, pulled)
+	}
+	if status, _ = get("since=x"); status != http.StatusBadRequest {
+		t.Errorf("Expected bad request, got %d", status)
+	}
+}
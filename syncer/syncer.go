@@ -0,0 +1,415 @@
+// Package syncer synchronizes tables of a local SQLite database, such as one
+// opened with the sqljs driver in a browser, with a server, allowing data to
+// be edited offline and reconciled later.
+//
+// Local changes are captured by a changelog.Log. A Client pushes them to the
+// server and pulls changes made by other clients, resolving conflicts between
+// local and remote changes to the same row with a Resolver. Server is a
+// reference implementation of the server side of the protocol.
+//
+// Protocol
+//
+// The protocol exchanges JSON documents over HTTP. The server keeps a single
+// ordered list of changes, each of which is assigned an increasing sequence
+// number when it is pushed. Changes are encoded as Change objects:
+//
+//    {
+//        "seq": 42,
+//        "client": "laptop",
+//        "table": "todos",
+//        "op": "UPDATE",
+//        "key": [1],
+//        "old": {"id": 1, "title": "draft"},
+//        "new": {"id": 1, "title": "final"},
+//        "time": "2021-06-01T12:00:00.123Z"
+//    }
+//
+// op is one of INSERT, UPDATE or DELETE, key is a JSON array of the primary
+// key values of the row, and old and new are the values of the row before
+// and after the change, omitted for inserts and deletes respectively.
+//
+// Changes are pulled with:
+//
+//    GET <url>/pull?since=<seq>&limit=<n>
+//
+// which responds with the changes whose sequence number is greater than
+// since, at most limit of them:
+//
+//    {"changes": [...], "seq": <seq of the last change returned>, "more": <true if changes remain>}
+//
+// If there are no new changes, seq is equal to since.
+//
+// Changes are pushed with:
+//
+//    POST <url>/push
+//    {"client": "<client id>", "since": <seq>, "changes": [...]}
+//
+// where since is the sequence number of the last change the client has
+// pulled. The seq and client fields of pushed changes are ignored. If other
+// changes have been pushed since then, the server responds with status 409
+// Conflict, and the client must pull and resolve conflicts before pushing
+// again. Otherwise, the changes are appended to the list, and the server
+// responds with the sequence number of the last one:
+//
+//    {"seq": <seq>}
+//
+// Errors are reported with a 4xx or 5xx status and a body of the form
+// {"error": "<message>"}.
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flimzy/go-sql.js/changelog"
+	"github.com/flimzy/go-sql.js/script"
+)
+
+// Change is a change to a row, as exchanged with the server.
+type Change struct {
+	Seq    int64           `json:"seq"`
+	Client string          `json:"client"`
+	Table  string          `json:"table"`
+	Op     changelog.Op    `json:"op"`
+	Key    json.RawMessage `json:"key"`
+	Old    json.RawMessage `json:"old,omitempty"`
+	New    json.RawMessage `json:"new,omitempty"`
+	Time   time.Time       `json:"time"`
+}
+
+func (c Change) local() changelog.Change {
+	return changelog.Change{Seq: c.Seq, Table: c.Table, Op: c.Op, Key: c.Key, Old: c.Old, New: c.New, Time: c.Time}
+}
+
+type pullResponse struct {
+	Changes []Change `json:"changes"`
+	Seq     int64    `json:"seq"`
+	More    bool     `json:"more"`
+}
+
+type pushRequest struct {
+	Client  string   `json:"client"`
+	Since   int64    `json:"since"`
+	Changes []Change `json:"changes"`
+}
+
+type pushResponse struct {
+	Seq int64 `json:"seq"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ErrOutOfDate is returned by Push when the server has changes which have not
+// been pulled.
+var ErrOutOfDate = errors.New("syncer: changes must be pulled before pushing")
+
+// A Resolver resolves a conflict between a pending local change and a remote
+// change to the same row. It returns the values the row should hold, as a
+// JSON object, or nil if the row should be deleted. If the result differs
+// from remote.New, it is recorded as a local change and pushed to the server.
+type Resolver func(local, remote changelog.Change) (json.RawMessage, error)
+
+// LastWriterWins resolves conflicts in favour of the most recent change. If
+// both changes have the same time, the remote change wins.
+func LastWriterWins(local, remote changelog.Change) (json.RawMessage, error) {
+	if local.Time.After(remote.Time) {
+		return local.New, nil
+	}
+	return remote.New, nil
+}
+
+// DefaultBatchSize is the number of changes pushed or pulled per request when
+// Client.BatchSize is 0.
+const DefaultBatchSize = 500
+
+// DefaultStateTable is the table in which a Client records the last change
+// it has pulled, when Client.StateTable is empty.
+const DefaultStateTable = "_sync_state"
+
+// Client synchronizes a local database with a server.
+type Client struct {
+	// Log records the local changes to push. Its tables must be tracked
+	// before synchronizing.
+	Log *changelog.Log
+	// URL is the base URL of the server.
+	URL string
+	// ID identifies the client to the server. Changes pulled from the
+	// server which were pushed by the same client are skipped.
+	ID string
+	// HTTPClient is used to make requests. It defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+	// Resolve resolves conflicts. It defaults to LastWriterWins.
+	Resolve Resolver
+	// BatchSize is the maximum number of changes per request. It defaults to
+	// DefaultBatchSize.
+	BatchSize int
+	// StateTable is the name of the table in which the sequence number of
+	// the last change pulled from each server is recorded. It defaults to
+	// DefaultStateTable.
+	StateTable string
+}
+
+func (c *Client) batchSize() int {
+	if c.BatchSize > 0 {
+		return c.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+func (c *Client) stateTable() string {
+	if c.StateTable == "" {
+		return DefaultStateTable
+	}
+	return c.StateTable
+}
+
+// Seq returns the sequence number of the last change pulled from the server.
+func (c *Client) Seq() (int64, error) {
+	if err := c.initState(c.Log.DB); err != nil {
+		return 0, err
+	}
+	var seq int64
+	err := c.Log.DB.QueryRow("SELECT seq FROM "+script.QuoteIdent(c.stateTable())+" WHERE url = ?", c.URL).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (c *Client) initState(e execer) error {
+	_, err := e.Exec("CREATE TABLE IF NOT EXISTS " + script.QuoteIdent(c.stateTable()) +
+		" (url TEXT PRIMARY KEY, seq INTEGER NOT NULL)")
+	return err
+}
+
+func (c *Client) setSeq(e execer, seq int64) error {
+	if err := c.initState(e); err != nil {
+		return err
+	}
+	_, err := e.Exec("INSERT OR REPLACE INTO "+script.QuoteIdent(c.stateTable())+" (url, seq) VALUES (?, ?)", c.URL, seq)
+	return err
+}
+
+// Sync pulls remote changes and then pushes local ones, repeating if other
+// clients push changes in the meantime.
+func (c *Client) Sync(ctx context.Context) error {
+	for {
+		if _, err := c.Pull(ctx); err != nil {
+			return err
+		}
+		_, err := c.Push(ctx)
+		if err != ErrOutOfDate {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// Pull applies the changes made on the server since the last pull, and
+// returns the number of changes applied. Remote changes are not recorded in
+// the local change log.
+func (c *Client) Pull(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		seq, err := c.Seq()
+		if err != nil {
+			return total, err
+		}
+		query := url.Values{
+			"since": {strconv.FormatInt(seq, 10)},
+			"limit": {strconv.Itoa(c.batchSize())},
+		}
+		var resp pullResponse
+		if err := c.do(ctx, http.MethodGet, "/pull?"+query.Encode(), nil, &resp); err != nil {
+			return total, err
+		}
+		n, err := c.apply(resp)
+		total += n
+		if err != nil || !resp.More {
+			return total, err
+		}
+	}
+}
+
+func (c *Client) apply(resp pullResponse) (n int, err error) {
+	if err := c.Log.Compact(); err != nil {
+		return 0, err
+	}
+	pending, err := c.Log.Pending(0)
+	if err != nil {
+		return 0, err
+	}
+	type rowID struct{ table, key string }
+	local := make(map[rowID]changelog.Change, len(pending))
+	for _, p := range pending {
+		local[rowID{p.Table, string(p.Key)}] = p
+	}
+
+	tx, err := c.Log.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	mark, err := c.Log.LastSeq(tx)
+	if err != nil {
+		return 0, err
+	}
+	// The last remote change to each row with a pending local change.
+	conflicts := make(map[rowID]Change)
+	var order []rowID
+	for _, remote := range resp.Changes {
+		if remote.Client == c.ID {
+			continue
+		}
+		if err := changelog.Apply(tx, remote.local()); err != nil {
+			return n, fmt.Errorf("syncer: apply change %d: %w", remote.Seq, err)
+		}
+		n++
+		id := rowID{remote.Table, string(remote.Key)}
+		if _, ok := local[id]; ok {
+			if _, ok := conflicts[id]; !ok {
+				order = append(order, id)
+			}
+			conflicts[id] = remote
+		}
+	}
+	if err := c.Log.Discard(tx, mark); err != nil {
+		return n, err
+	}
+	resolve := c.Resolve
+	if resolve == nil {
+		resolve = LastWriterWins
+	}
+	for _, id := range order {
+		mine, remote := local[id], conflicts[id].local()
+		row, err := resolve(mine, remote)
+		if err != nil {
+			return n, err
+		}
+		if err := c.Log.Remove(tx, mine.Seq); err != nil {
+			return n, err
+		}
+		if equalJSON(row, remote.New) {
+			continue
+		}
+		// Applying the resolution records it as a new local change.
+		resolved := remote
+		resolved.New = row
+		if err := changelog.Apply(tx, resolved); err != nil {
+			return n, fmt.Errorf("syncer: apply resolution: %w", err)
+		}
+	}
+	return n, c.setSeq(tx, resp.Seq)
+}
+
+func equalJSON(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// Push sends pending local changes to the server, and returns the number of
+// changes sent. If the server has changes which have not been pulled, it
+// returns ErrOutOfDate.
+func (c *Client) Push(ctx context.Context) (int, error) {
+	if err := c.Log.Compact(); err != nil {
+		return 0, err
+	}
+	total := 0
+	for {
+		pending, err := c.Log.Pending(c.batchSize())
+		if err != nil || len(pending) == 0 {
+			return total, err
+		}
+		seq, err := c.Seq()
+		if err != nil {
+			return total, err
+		}
+		req := pushRequest{Client: c.ID, Since: seq, Changes: make([]Change, len(pending))}
+		for i, p := range pending {
+			req.Changes[i] = Change{Table: p.Table, Op: p.Op, Key: p.Key, Old: p.Old, New: p.New, Time: p.Time}
+		}
+		var resp pushResponse
+		if err := c.do(ctx, http.MethodPost, "/push", req, &resp); err != nil {
+			return total, err
+		}
+		// The pushed changes need not be pulled again.
+		if err := c.setSeq(c.Log.DB, resp.Seq); err != nil {
+			return total, err
+		}
+		if err := c.Log.Ack(pending[len(pending)-1].Seq); err != nil {
+			return total, err
+		}
+		total += len(pending)
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.URL, "/")+path, r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		return ErrOutOfDate
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if json.NewDecoder(resp.Body).Decode(&e) != nil || e.Error == "" {
+			e.Error = resp.Status
+		}
+		return fmt.Errorf("syncer: %s %s: %s", method, path, e.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
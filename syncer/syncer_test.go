@@ -0,0 +1,160 @@
+// +build js
+
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/flimzy/go-sql.js/changelog"
+	"github.com/flimzy/go-sql.js/internal/synctest"
+)
+
+func newClient(t *testing.T, id string, srv http.Handler) (*Client, func()) {
+	log, done := synctest.NewLog(t)
+	c := &Client{
+		Log:        log,
+		URL:        "http://sync.example/api",
+		ID:         id,
+		HTTPClient: synctest.Client(srv),
+	}
+	return c, done
+}
+
+func TestFirstSync(t *testing.T) {
+	srv := &Server{}
+	ctx := context.Background()
+	c, closeC := newClient(t, "a", srv)
+	defer closeC()
+
+	if seq, err := c.Seq(); err != nil || seq != 0 {
+		t.Fatalf("Expected sequence 0 before the first sync, got %d, %v", seq, err)
+	}
+	if n, err := c.Pull(ctx); err != nil || n != 0 {
+		t.Fatalf("Expected nothing to pull from an empty server, got %d, %v", n, err)
+	}
+	if err := c.Sync(ctx); err != nil {
+		t.Fatalf("Error syncing an empty database: %s", err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	srv := &Server{}
+	ctx := context.Background()
+	a, closeA := newClient(t, "a", srv)
+	defer closeA()
+	b, closeB := newClient(t, "b", srv)
+	defer closeB()
+
+	synctest.Exec(t, a.Log.DB, "INSERT INTO todos (id, title) VALUES (1, 'one'), (2, 'two')")
+	synctest.Exec(t, a.Log.DB, "UPDATE todos SET title = 'uno' WHERE id = 1")
+	if err := a.Sync(ctx); err != nil {
+		t.Fatalf("Error syncing a: %s", err)
+	}
+	if changes := srv.Changes(0); len(changes) != 2 {
+		t.Fatalf("Expected compacted changes on server, got %+v", changes)
+	}
+
+	synctest.Exec(t, b.Log.DB, "INSERT INTO todos (id, title) VALUES (3, 'three')")
+	if _, err := b.Push(ctx); err != ErrOutOfDate {
+		t.Fatalf("Expected ErrOutOfDate, got %v", err)
+	}
+	if err := b.Sync(ctx); err != nil {
+		t.Fatalf("Error syncing b: %s", err)
+	}
+	if err := a.Sync(ctx); err != nil {
+		t.Fatalf("Error syncing a: %s", err)
+	}
+	expected := map[int64]string{1: "uno", 2: "two", 3: "three"}
+	for _, c := range []*Client{a, b} {
+		if got := synctest.Todos(t, c.Log.DB); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Client %s: expected %v, got %v", c.ID, expected, got)
+		}
+		if pending, _ := c.Log.Pending(0); len(pending) != 0 {
+			t.Errorf("Client %s: pulled changes were recorded: %+v", c.ID, pending)
+		}
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	srv := &Server{}
+	ctx := context.Background()
+	a, closeA := newClient(t, "a", srv)
+	defer closeA()
+	b, closeB := newClient(t, "b", srv)
+	defer closeB()
+
+	synctest.Exec(t, a.Log.DB, "INSERT INTO todos (id, title) VALUES (1, 'one'), (2, 'two')")
+	if err := a.Sync(ctx); err != nil {
+		t.Fatalf("Error syncing a: %s", err)
+	}
+	if err := b.Sync(ctx); err != nil {
+		t.Fatalf("Error syncing b: %s", err)
+	}
+
+	// b's edit to row 1 is older than a's; a's edit to row 2 is older than
+	// b's deletion.
+	synctest.Exec(t, b.Log.DB, "UPDATE todos SET title = 'b' WHERE id = 1")
+	synctest.Exec(t, a.Log.DB, "UPDATE todos SET title = 'a' WHERE id = 2")
+	synctest.Exec(t, b.Log.DB, "DELETE FROM todos WHERE id = 2")
+	synctest.Exec(t, a.Log.DB, "UPDATE todos SET title = 'a' WHERE id = 1")
+	// Make the order of the edits unambiguous.
+	synctest.Exec(t, b.Log.DB, "UPDATE _changelog SET time = '2021-06-01T12:00:00.000Z' WHERE row_key = '[1]'")
+	synctest.Exec(t, a.Log.DB, "UPDATE _changelog SET time = '2021-06-01T12:00:01.000Z' WHERE row_key = '[1]'")
+	synctest.Exec(t, a.Log.DB, "UPDATE _changelog SET time = '2021-06-01T12:00:02.000Z' WHERE row_key = '[2]'")
+	synctest.Exec(t, b.Log.DB, "UPDATE _changelog SET time = '2021-06-01T12:00:03.000Z' WHERE row_key = '[2]'")
+
+	for _, c := range []*Client{a, b, a} {
+		if err := c.Sync(ctx); err != nil {
+			t.Fatalf("Error syncing %s: %s", c.ID, err)
+		}
+	}
+	expected := map[int64]string{1: "a"}
+	for _, c := range []*Client{a, b} {
+		if got := synctest.Todos(t, c.Log.DB); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Client %s: expected %v, got %v", c.ID, expected, got)
+		}
+	}
+}
+
+func TestCustomResolver(t *testing.T) {
+	srv := &Server{}
+	ctx := context.Background()
+	a, closeA := newClient(t, "a", srv)
+	defer closeA()
+	b, closeB := newClient(t, "b", srv)
+	defer closeB()
+	// Merge conflicting titles.
+	b.Resolve = func(local, remote changelog.Change) (json.RawMessage, error) {
+		var l, r map[string]interface{}
+		if err := json.Unmarshal(local.New, &l); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(remote.New, &r); err != nil {
+			return nil, err
+		}
+		r["title"] = r["title"].(string) + "+" + l["title"].(string)
+		return json.Marshal(r)
+	}
+
+	synctest.Exec(t, a.Log.DB, "INSERT INTO todos (id, title) VALUES (1, 'a')")
+	synctest.Exec(t, b.Log.DB, "INSERT INTO todos (id, title) VALUES (1, 'b')")
+	if err := a.Sync(ctx); err != nil {
+		t.Fatalf("Error syncing a: %s", err)
+	}
+	if err := b.Sync(ctx); err != nil {
+		t.Fatalf("Error syncing b: %s", err)
+	}
+	if err := a.Sync(ctx); err != nil {
+		t.Fatalf("Error syncing a: %s", err)
+	}
+	expected := map[int64]string{1: "a+b"}
+	for _, c := range []*Client{a, b} {
+		if got := synctest.Todos(t, c.Log.DB); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Client %s: expected %v, got %v", c.ID, expected, got)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package test
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/go-sql.js"
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+// fakeBackend is a Backend whose statements return canned rows, recording the
+// calls made by the driver.
+type fakeBackend struct {
+	rows     map[string][][]interface{}
+	prepared []string
+	run      []string
+	bound    [][]interface{}
+	freed    int
+}
+
+func (b *fakeBackend) Open(r io.Reader) (sqljs.BackendDatabase, error) {
+	return &fakeDatabase{b}, nil
+}
+
+type fakeDatabase struct {
+	b *fakeBackend
+}
+
+func (d *fakeDatabase) Prepare(query string) (sqljs.BackendStatement, error) {
+	if strings.HasPrefix(query, "PRAGMA") {
+		return &fakeStatement{b: d.b, rows: [][]interface{}{{int64(1)}}}, nil
+	}
+	rows, ok := d.b.rows[query]
+	if !ok {
+		return nil, errors.New("no such query")
+	}
+	d.b.prepared = append(d.b.prepared, query)
+	return &fakeStatement{b: d.b, rows: rows}, nil
+}
+
+func (d *fakeDatabase) Run(query string) error {
+	d.b.run = append(d.b.run, query)
+	return nil
+}
+
+func (d *fakeDatabase) RowsModified() int64        { return 3 }
+func (d *fakeDatabase) Export() (io.Reader, error) { return &bytes.Buffer{}, nil }
+func (d *fakeDatabase) Close() error               { return nil }
+
+type fakeStatement struct {
+	b    *fakeBackend
+	rows [][]interface{}
+	next int
+}
+
+func (s *fakeStatement) Bind(params []interface{}) error {
+	s.next = 0
+	s.b.bound = append(s.b.bound, params)
+	return nil
+}
+
+func (s *fakeStatement) Step() (bool, error) {
+	s.next++
+	return s.next <= len(s.rows), nil
+}
+
+func (s *fakeStatement) Get() ([]interface{}, error) {
+	return s.rows[s.next-1], nil
+}
+
+func (s *fakeStatement) ColumnNames() ([]string, error) {
+	return []string{"id", "name"}, nil
+}
+
+func (s *fakeStatement) Exec(params []interface{}) error {
+	return s.Bind(params)
+}
+
+func (s *fakeStatement) Reset() error {
+	s.next = 0
+	return nil
+}
+
+func (s *fakeStatement) Free() error {
+	s.b.freed++
+	return nil
+}
+
+func TestBackend(t *testing.T) {
+	const query = "SELECT id, name FROM t WHERE id > ?"
+	backend := &fakeBackend{rows: map[string][][]interface{}{
+		query:                   {{int64(1), "one"}, {int64(2), []byte("two")}},
+		"UPDATE t SET name = ?": nil,
+	}}
+	sql.Register("sqljs-fake", &sqljs.SQLJSDriver{Backend: backend})
+	db, err := sql.Open("sqljs-fake", "")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE t (id, name)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	res, err := db.Exec("UPDATE t SET name = ?", "x")
+	if err != nil {
+		t.Fatalf("Error updating: %s", err)
+	}
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Errorf("Expected 3 rows affected, got %d", n)
+	}
+
+	for i := 0; i < 2; i++ {
+		rows, err := db.Query(query, 0)
+		if err != nil {
+			t.Fatalf("Error querying: %s", err)
+		}
+		var got []string
+		for rows.Next() {
+			var id int
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				t.Fatalf("Error scanning: %s", err)
+			}
+			got = append(got, name)
+		}
+		rows.Close()
+		if !reflect.DeepEqual(got, []string{"one", "two"}) {
+			t.Errorf("Unexpected rows: %v", got)
+		}
+	}
+
+	if !reflect.DeepEqual(backend.run, []string{"CREATE TABLE t (id, name)"}) {
+		t.Errorf("Unexpected scripts run: %v", backend.run)
+	}
+	if !reflect.DeepEqual(backend.prepared, []string{"UPDATE t SET name = ?", query}) {
+		t.Errorf("Expected cached statements to be reused, prepared: %v", backend.prepared)
+	}
+	if len(backend.bound) != 3 || backend.bound[0][0] != "x" || backend.bound[2][0] != int64(0) {
+		t.Errorf("Unexpected parameters bound: %v", backend.bound)
+	}
+
+	sql.Register("sqljs-fake-ro", &sqljs.SQLJSDriver{Backend: backend, ReadOnly: true})
+	ro, err := sql.Open("sqljs-fake-ro", "")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer ro.Close()
+	if _, err := ro.Query(query, 0); err != sqljs.ErrReadOnlyUnsupported {
+		t.Errorf("Expected ErrReadOnlyUnsupported, got %v", err)
+	}
+}
+
+func TestBackendEmptyResult(t *testing.T) {
+	const query = "SELECT id, name FROM t WHERE id < 0"
+	sql.Register("sqljs-fake-empty", &sqljs.SQLJSDriver{Backend: &fakeBackend{rows: map[string][][]interface{}{
+		query: nil,
+	}}})
+	db, err := sql.Open("sqljs-fake-empty", "")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("Error querying: %s", err)
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("Error reading columns: %s", err)
+	}
+	if !reflect.DeepEqual(cols, []string{"id", "name"}) {
+		t.Errorf("Unexpected columns: %v", cols)
+	}
+	if rows.Next() {
+		t.Errorf("Expected no rows")
+	}
+	if err := rows.Err(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	rows.Close()
+
+	var id int
+	if err := db.QueryRow(query).Scan(&id); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestBackendIgnoresSQLJSOptions(t *testing.T) {
+	sql.Register("sqljs-fake-hook", &sqljs.SQLJSDriver{
+		Backend: &fakeBackend{},
+		ConnectHook: func(*bindings.Database) error {
+			return errors.New("ConnectHook called")
+		},
+	})
+	db, err := sql.Open("sqljs-fake-hook", "")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Errorf("Expected ConnectHook to be ignored, got %s", err)
+	}
+}
@@ -0,0 +1,199 @@
+// +build !js
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/flimzy/go-sql.js"
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+// openNative opens a database with the default backend, which stores it with
+// the native driver.
+func openNative(t *testing.T, dsn string) *sql.DB {
+	db, err := sql.Open("sqljs", dsn)
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestNative(t *testing.T) {
+	db := openNative(t, "")
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, score REAL, data BLOB)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	stmt, err := db.Prepare("INSERT INTO t (name, score, data) VALUES (?, ?, ?)")
+	if err != nil {
+		t.Fatalf("Error preparing: %s", err)
+	}
+	for _, args := range [][]interface{}{
+		{"one", 1.5, []byte{0, 255}},
+		{"two", nil, nil},
+	} {
+		if _, err := stmt.Exec(args...); err != nil {
+			t.Fatalf("Error inserting: %s", err)
+		}
+	}
+	stmt.Close()
+	res, err := db.Exec("UPDATE t SET score = 2 WHERE score IS NULL OR id = ?", 1)
+	if err != nil {
+		t.Fatalf("Error updating: %s", err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("Expected 2 rows affected, got %d", n)
+	}
+
+	rows, err := db.Query("SELECT id, name, score, data FROM t WHERE id > ? ORDER BY id", 0)
+	if err != nil {
+		t.Fatalf("Error querying: %s", err)
+	}
+	var got [][]interface{}
+	for rows.Next() {
+		row := make([]interface{}, 4)
+		if err := rows.Scan(&row[0], &row[1], &row[2], &row[3]); err != nil {
+			t.Fatalf("Error scanning: %s", err)
+		}
+		got = append(got, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Error stepping: %s", err)
+	}
+	rows.Close()
+	expected := [][]interface{}{
+		{int64(1), "one", 2.0, []byte{0, 255}},
+		{int64(2), "two", 2.0, nil},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected rows: %v", got)
+	}
+
+	var id int
+	if err := db.QueryRow("SELECT id FROM t WHERE id < 0").Scan(&id); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestNativeErrors(t *testing.T) {
+	db := openNative(t, "")
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE t (x UNIQUE, y NOT NULL)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	if _, err := db.Exec("INSERT INTO t VALUES (1, 1)"); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	tests := map[string]*bindings.Error{
+		"INSERT INTO t VALUES (1, 2)":    bindings.ErrConstraintUnique,
+		"INSERT INTO t VALUES (2, NULL)": bindings.ErrConstraintNotNull,
+		"INSERT INTO missing VALUES (1)": bindings.ErrError,
+		"SELECT FROM":                    bindings.ErrError,
+	}
+	for query, expected := range tests {
+		_, err := db.Exec(query)
+		var e *bindings.Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: expected an *Error, got %v", query, err)
+			continue
+		}
+		if !errors.Is(err, expected) || e.SQL != query {
+			t.Errorf("%s: expected %s, got code %d/%d: %s", query, expected, e.Code, e.ExtendedCode, e)
+		}
+	}
+}
+
+func TestNativeTimes(t *testing.T) {
+	db := openNative(t, "")
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE t (at DATETIME, day DATE)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	if _, err := db.Exec("INSERT INTO t VALUES ('2021-06-01 12:30:00', date('2021-06-01'))"); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	at := time.Date(2021, 6, 2, 8, 0, 0, 500000000, time.UTC)
+	if _, err := db.Exec("INSERT INTO t VALUES (?, ?)", at, at); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+
+	rows, err := db.Query("SELECT at, day, typeof(at) FROM t ORDER BY rowid")
+	if err != nil {
+		t.Fatalf("Error querying: %s", err)
+	}
+	var got [][]interface{}
+	for rows.Next() {
+		row := make([]interface{}, 3)
+		if err := rows.Scan(&row[0], &row[1], &row[2]); err != nil {
+			t.Fatalf("Error scanning: %s", err)
+		}
+		got = append(got, row)
+	}
+	rows.Close()
+	expected := [][]interface{}{
+		{"2021-06-01 12:30:00", "2021-06-01", "text"},
+		{"2021-06-02 08:00:00.5", "2021-06-02 08:00:00.5", "text"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected rows: %v", got)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := sqljs.Dump(db, buf, sqljs.DumpOptions{DataOnly: true}); err != nil {
+		t.Fatalf("Error dumping: %s", err)
+	}
+	if !strings.Contains(buf.String(), `VALUES('2021-06-01 12:30:00','2021-06-01');`) {
+		t.Errorf("Expected times to be dumped as stored:\n%s", buf)
+	}
+}
+
+func TestNativeExport(t *testing.T) {
+	db := openNative(t, "")
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE t (x); INSERT INTO t VALUES (1), (2)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Error getting connection: %s", err)
+	}
+	var exported io.Reader
+	err = conn.Raw(func(c interface{}) error {
+		var err error
+		exported, err = c.(*sqljs.SQLJSConn).Backend().Export()
+		return err
+	})
+	conn.Close()
+	if err != nil {
+		t.Fatalf("Error exporting: %s", err)
+	}
+
+	if err := sqljs.AddReader("native-export", exported); err != nil {
+		t.Fatalf("Error adding reader: %s", err)
+	}
+	copied := openNative(t, "native-export")
+	defer copied.Close()
+	var sum int
+	if err := copied.QueryRow("SELECT sum(x) FROM t").Scan(&sum); err != nil {
+		t.Fatalf("Error querying exported database: %s", err)
+	}
+	if sum != 3 {
+		t.Errorf("Expected sum 3 in exported database, got %d", sum)
+	}
+}
@@ -4,12 +4,19 @@ package test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"database/sql"
 	"github.com/flimzy/go-sql.js"
+	"github.com/flimzy/go-sql.js/bindings"
+	"github.com/flimzy/go-sql.js/fts"
 )
 
 func TestOpenEmpty(t *testing.T) {
@@ -18,8 +25,13 @@ func TestOpenEmpty(t *testing.T) {
 		t.Fatalf("Error opening empty database: %s", err)
 	}
 
-	if _, err := db.Prepare("an invalid statement"); err.Error() != "JavaScript error: near \"an\": syntax error" {
-		t.Fatalf("Error preparing statement: %s", err)
+	_, err = db.Prepare("an invalid statement")
+	var sqlErr *sqljs.Error
+	if !errors.As(err, &sqlErr) || sqlErr.Message != "near \"an\": syntax error" || sqlErr.SQL != "an invalid statement" {
+		t.Fatalf("Error preparing statement: %#v", err)
+	}
+	if !errors.Is(err, sqljs.ErrError) {
+		t.Fatalf("Unexpected result code: %d", sqlErr.Code)
 	}
 
 	stmt, err := db.Prepare("SELECT 1 AS foo")
@@ -106,6 +118,386 @@ func TestOpenExisting(t *testing.T) {
 	}
 }
 
+func TestColumnTypes(t *testing.T) {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening empty database: %s", err)
+	}
+	if _, err := db.Exec("CREATE TABLE foo (created datetime, flag BOOLEAN)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	if _, err := db.Exec("INSERT INTO foo VALUES ('2017-01-01', 1)"); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	rows, err := db.Query("SELECT created, flag, 1 FROM foo")
+	if err != nil {
+		t.Fatalf("Error executing query: %s", err)
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("Error fetching column types: %s", err)
+	}
+	for i, expected := range []string{"DATETIME", "BOOLEAN", ""} {
+		if name := types[i].DatabaseTypeName(); name != expected {
+			t.Fatalf("Column %d: unexpected type %q, expected %q", i, name, expected)
+		}
+	}
+	rows.Close()
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing database: %s", err)
+	}
+}
+
+func TestBlobs(t *testing.T) {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening empty database: %s", err)
+	}
+	if _, err := db.Exec("CREATE TABLE foo (id int, b BLOB)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	blob := []byte("\x00binary\x00data\x00")
+	if _, err := db.Exec("INSERT INTO foo VALUES (1, ?), (2, ?)", blob, sql.RawBytes(blob)); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+
+	rows, err := db.Query("SELECT b, typeof(b) FROM foo ORDER BY id")
+	if err != nil {
+		t.Fatalf("Error executing query: %s", err)
+	}
+	for rows.Next() {
+		var b sql.RawBytes
+		var typ string
+		if err := rows.Scan(&b, &typ); err != nil {
+			t.Fatalf("Error scanning row: %s", err)
+		}
+		if typ != "blob" || !bytes.Equal(b, blob) {
+			t.Fatalf("Unexpected result: %q (%s)", b, typ)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Error iterating rows: %s", err)
+	}
+
+	var b []byte
+	if err := db.QueryRow("SELECT b FROM foo WHERE id=1").Scan(&b); err != nil {
+		t.Fatalf("Error scanning []byte: %s", err)
+	}
+	if !bytes.Equal(b, blob) {
+		t.Fatalf("Unexpected result: %q", b)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing database: %s", err)
+	}
+}
+
+func TestInt64(t *testing.T) {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening empty database: %s", err)
+	}
+	if _, err := db.Exec("CREATE TABLE foo (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	const big = int64(9007199254740993) // 2^53 + 1
+	if _, err := db.Exec("INSERT INTO foo VALUES (?)", big); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	var id interface{}
+	if err := db.QueryRow("SELECT id FROM foo").Scan(&id); err != nil {
+		t.Fatalf("Error scanning: %s", err)
+	}
+	if id != big {
+		t.Fatalf("Unexpected id: %#v", id)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing database: %s", err)
+	}
+}
+
+func TestConstraintErrors(t *testing.T) {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening empty database: %s", err)
+	}
+	if _, err := db.Exec("CREATE TABLE foo (id int UNIQUE, name text NOT NULL)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	if _, err := db.Exec("INSERT INTO foo VALUES (1, 'a')"); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	_, err = db.Exec("INSERT INTO foo VALUES (1, 'b')")
+	if !errors.Is(err, sqljs.ErrConstraintUnique) || !errors.Is(err, sqljs.ErrConstraint) {
+		t.Fatalf("Expected a UNIQUE constraint error, got: %v", err)
+	}
+	if errors.Is(err, sqljs.ErrConstraintNotNull) {
+		t.Fatal("UNIQUE constraint error matched NOT NULL sentinel")
+	}
+	_, err = db.Exec("INSERT INTO foo VALUES (2, NULL)")
+	if !errors.Is(err, sqljs.ErrConstraintNotNull) {
+		t.Fatalf("Expected a NOT NULL constraint error, got: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing database: %s", err)
+	}
+}
+
+func TestStatementCache(t *testing.T) {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening empty database: %s", err)
+	}
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Error getting connection: %s", err)
+	}
+	defer conn.Close()
+	stats := func() (s sqljs.CacheStats) {
+		conn.Raw(func(c interface{}) error {
+			s = c.(*sqljs.SQLJSConn).CacheStats()
+			return nil
+		})
+		return s
+	}
+	ctx := context.Background()
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE foo (x int)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	before := stats()
+	for i := 0; i < 5; i++ {
+		if _, err := conn.ExecContext(ctx, "INSERT INTO foo (x) VALUES (?)", i); err != nil {
+			t.Fatalf("Error inserting: %s", err)
+		}
+	}
+	after := stats()
+	if hits := after.Hits - before.Hits; hits != 4 {
+		t.Fatalf("Expected 4 cache hits, got %d", hits)
+	}
+	if misses := after.Misses - before.Misses; misses != 1 {
+		t.Fatalf("Expected 1 cache miss, got %d", misses)
+	}
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE bar (y int)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO foo (x) VALUES (?)", 5); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	if s := stats(); s.Invalidations == 0 {
+		t.Fatal("Expected schema change to invalidate the cache")
+	}
+	var count int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM foo").Scan(&count); err != nil {
+		t.Fatalf("Error counting: %s", err)
+	}
+	if count != 6 {
+		t.Fatalf("Expected 6 rows, found %d", count)
+	}
+
+	// A statement prepared before a schema change, and closed after the
+	// cache has seen the change, must not be cached.
+	stmt, err := conn.PrepareContext(ctx, "SELECT x FROM foo")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE baz (z int)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO foo (x) VALUES (?)", 6); err != nil {
+		t.Fatalf("Error inserting: %s", err)
+	}
+	stmt.Close()
+	before = stats()
+	stmt, err = conn.PrepareContext(ctx, "SELECT x FROM foo")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err)
+	}
+	stmt.Close()
+	if misses := stats().Misses - before.Misses; misses != 1 {
+		t.Fatal("Expected the statement prepared before the schema change not to be reused")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	var traced []string
+	sql.Register("sqljs-readonly", &sqljs.SQLJSDriver{
+		ReadOnly: true,
+		Trace: func(query string) {
+			traced = append(traced, query)
+		},
+	})
+	reader, _ := OpenTestDb(t)
+	sqljs.AddReader("readonly.db", reader)
+	db, err := sql.Open("sqljs-readonly", "readonly.db")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+
+	if _, err := db.Exec("INSERT INTO test (id,name) VALUES (3,'John')"); err != sqljs.ErrReadOnly {
+		t.Fatalf("Unexpected error for write on read-only connection: %v", err)
+	}
+
+	var name string
+	if err := db.QueryRow("SELECT name FROM test WHERE id=?", 2).Scan(&name); err != nil {
+		t.Fatalf("Error querying read-only connection: %s", err)
+	}
+	if name != "Alice" {
+		t.Fatalf("Unexpected result: %s", name)
+	}
+	if len(traced) != 1 || traced[0] != "SELECT name FROM test WHERE id=2" {
+		t.Fatalf("Unexpected trace: %q", traced)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Error closing database: %s", err)
+	}
+}
+
+func TestDump(t *testing.T) {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening empty database: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE foo (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, score REAL, data BLOB);
+INSERT INTO foo (name, score, data) VALUES ('it''s', 2, x'00ff'), (NULL, 1.5, NULL);
+CREATE INDEX foo_name ON foo (name);
+CREATE TABLE bar (x);
+INSERT INTO bar VALUES (1);
+CREATE VIEW foo_names AS SELECT name FROM foo;`)
+	if err != nil {
+		t.Fatalf("Error creating test data: %s", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := sqljs.Dump(db, buf, sqljs.DumpOptions{Tables: []string{"foo"}}); err != nil {
+		t.Fatalf("Error dumping: %s", err)
+	}
+	expected := `PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE foo (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, score REAL, data BLOB);
+INSERT INTO "foo" VALUES(1,'it''s',2.0,X'00ff');
+INSERT INTO "foo" VALUES(2,NULL,1.5,NULL);
+CREATE INDEX foo_name ON foo (name);
+COMMIT;
+`
+	if buf.String() != expected {
+		t.Fatalf("Unexpected dump:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := sqljs.Dump(db, buf, sqljs.DumpOptions{}); err != nil {
+		t.Fatalf("Error dumping: %s", err)
+	}
+	restored, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening empty database: %s", err)
+	}
+	defer restored.Close()
+	restored.SetMaxOpenConns(1)
+	if _, err := restored.Exec(buf.String()); err != nil {
+		t.Fatalf("Error restoring dump: %s", err)
+	}
+	var seq int
+	if err := restored.QueryRow("SELECT seq FROM sqlite_sequence WHERE name='foo'").Scan(&seq); err != nil || seq != 2 {
+		t.Fatalf("Unexpected sequence after restoring: %d, %v", seq, err)
+	}
+
+	buf.Reset()
+	if err := sqljs.Dump(db, buf, sqljs.DumpOptions{Tables: []string{"bar"}, DataOnly: true}); err != nil {
+		t.Fatalf("Error dumping: %s", err)
+	}
+	if expected := "PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\nINSERT INTO \"bar\" VALUES(1);\nCOMMIT;\n"; buf.String() != expected {
+		t.Fatalf("Unexpected data-only dump:\n%s", buf.String())
+	}
+}
+
+func TestDumpVirtualTable(t *testing.T) {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening empty database: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE docs (id INTEGER PRIMARY KEY, body TEXT);
+INSERT INTO docs VALUES (1, 'hello world'), (2, 'goodbye');`)
+	if err != nil {
+		t.Fatalf("Error creating test data: %s", err)
+	}
+	ix := &fts.Index{DB: db, Name: "docs_fts", Table: "docs", Columns: []string{"body"}}
+	if err := ix.Create(); err == fts.ErrUnsupported {
+		t.Skip("FTS not available")
+	} else if err != nil {
+		t.Fatalf("Error creating index: %s", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := sqljs.Dump(db, buf, sqljs.DumpOptions{}); err != nil {
+		t.Fatalf("Error dumping: %s", err)
+	}
+	if strings.Contains(buf.String(), "CREATE TABLE 'docs_fts_") || strings.Contains(buf.String(), "CREATE TABLE \"docs_fts_") {
+		t.Fatalf("Dump includes shadow tables:\n%s", buf.String())
+	}
+	restored, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening empty database: %s", err)
+	}
+	defer restored.Close()
+	restored.SetMaxOpenConns(1)
+	if _, err := restored.Exec(buf.String()); err != nil {
+		t.Fatalf("Error restoring dump: %s\n%s", err, buf.String())
+	}
+	ix.DB = restored
+	results, err := ix.Search(fts.Escape("hello"), fts.SearchOptions{})
+	if err != nil {
+		t.Fatalf("Error searching restored index: %s", err)
+	}
+	if len(results) != 1 || results[0].Rowid != 1 {
+		t.Fatalf("Unexpected results: %v", results)
+	}
+}
+
+func TestImportScript(t *testing.T) {
+	db, err := sql.Open("sqljs", "")
+	if err != nil {
+		t.Fatalf("Error opening empty database: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	script := `CREATE TABLE foo (x TEXT);
+CREATE TABLE log (x TEXT);
+CREATE TRIGGER foo_log AFTER INSERT ON foo BEGIN
+	INSERT INTO log VALUES ('inserted; ' || new.x);
+END;
+INSERT INTO foo VALUES ('a');
+-- the next statement fails
+INSERT INTO nonexistent VALUES (1);
+INSERT INTO foo VALUES ('b');
+`
+	var statements []int
+	err = sqljs.ImportScript(db, strings.NewReader(script), func(p sqljs.ScriptProgress) {
+		statements = append(statements, p.Statement)
+	})
+	var scriptErr *sqljs.ScriptError
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("Expected a ScriptError, got: %v", err)
+	}
+	if scriptErr.Statement != 5 || scriptErr.Line != 8 || !errors.Is(err, sqljs.ErrError) {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(statements) != 4 {
+		t.Fatalf("Unexpected progress: %v", statements)
+	}
+	var logged string
+	if err := db.QueryRow("SELECT x FROM log").Scan(&logged); err != nil || logged != "inserted; a" {
+		t.Fatalf("Unexpected log: %s, %v", logged, err)
+	}
+}
+
 func OpenTestDb(t *testing.T) (io.Reader, []byte) {
 	file, err := os.Open("../bindings/test.db")
 	if err != nil {
@@ -119,3 +511,65 @@ func OpenTestDb(t *testing.T) (io.Reader, []byte) {
 	}
 	return bytes.NewReader(byteArray), byteArray
 }
+
+func TestJournal(t *testing.T) {
+	journal := new(bytes.Buffer)
+	sql.Register("sqljs-journal", &sqljs.SQLJSDriver{Journal: journal})
+	db, err := sql.Open("sqljs-journal", "")
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE foo (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Error beginning transaction: %s", err)
+	}
+	for i, name := range []string{"a", "b"} {
+		if _, err := tx.Exec("INSERT INTO foo (id, name) VALUES (?, ?)", i, name); err != nil {
+			t.Fatalf("Error inserting: %s", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Error committing: %s", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM foo").Scan(&count); err != nil {
+		t.Fatalf("Error counting: %s", err)
+	}
+	// A statement run through Query is journaled when it is first stepped.
+	rows, err := db.Query("DELETE FROM foo WHERE id = ?", 0)
+	if err != nil {
+		t.Fatalf("Error deleting: %s", err)
+	}
+	rows.Close()
+	if _, err := db.Exec("INSERT INTO foo (id, name) VALUES (?, ?)", 2, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)); err != nil {
+		t.Fatalf("Error inserting time: %s", err)
+	}
+
+	expected := `{"q":"CREATE TABLE foo (id INTEGER PRIMARY KEY, name TEXT)"}
+{"q":"BEGIN"}
+{"q":"INSERT INTO foo (id, name) VALUES (?, ?)","p":[0,"a"]}
+{"q":"INSERT INTO foo (id, name) VALUES (?, ?)","p":[1,"b"]}
+{"q":"COMMIT"}
+{"q":"DELETE FROM foo WHERE id = ?","p":[0]}
+{"q":"INSERT INTO foo (id, name) VALUES (?, ?)","p":[2,"2020-01-02T03:04:05Z"]}
+`
+	if journal.String() != expected {
+		t.Fatalf("Unexpected journal:\n%s", journal)
+	}
+
+	replayed := bindings.New()
+	defer replayed.Close()
+	if err := bindings.Replay(journal, replayed); err != nil {
+		t.Fatalf("Error replaying journal: %s", err)
+	}
+	res, err := replayed.Exec("SELECT name FROM foo ORDER BY id")
+	if err != nil || len(res) != 1 || !reflect.DeepEqual(res[0].Values, [][]interface{}{{"b"}, {"2020-01-02T03:04:05Z"}}) {
+		t.Fatalf("Unexpected replayed rows: %v, %v", res, err)
+	}
+}
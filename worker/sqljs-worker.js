@@ -0,0 +1,123 @@
+// sqljs-worker.js runs an SQL.js database inside a Web Worker, or a node.js
+// worker_threads Worker, for use with bindings.WorkerDatabase.
+//
+// Every request is an object with a numeric id and an action. Every reply
+// carries the same id, and either the result of the action or an error:
+//
+//     {id, action: "open", buffer}           -> {id, ready: true}
+//     {id, action: "exec", sql}              -> {id, results, rowsModified}
+//     {id, action: "run", sql, params}       -> {id, rowsModified}
+//     {id, action: "query", sql, params}     -> {id, columns, values, rowsModified}
+//     {id, action: "export"}                 -> {id, buffer}
+//     {id, action: "close"}                  -> {id}
+//     failure                                -> {id, error, code, extendedCode}
+//
+// In the browser, sql.js must be available at the path given by the
+// importScripts URL parameter "sqljs", or "sql.js" by default. Under node.js it
+// is loaded with require().
+
+var isNode = typeof process !== 'undefined' && process.versions != null && process.versions.node != null;
+var port, load;
+
+if (isNode) {
+    port = require('worker_threads').parentPort;
+    load = function() { return require('sql.js'); };
+} else {
+    port = self;
+    load = function() {
+        var src = new URLSearchParams(self.location.search).get('sqljs') || 'sql.js';
+        importScripts(src);
+        return self.initSqlJs || self.SQL;
+    };
+}
+
+// ready resolves to the SQL.js module, for both the older synchronous builds
+// and the newer initSqlJs() builds.
+var ready = Promise.resolve().then(function() {
+    var SQL = load();
+    return typeof SQL === 'function' ? SQL() : SQL;
+});
+
+var db = null;
+var config = { useBigInt: true };
+
+function errorCodes(SQL) {
+    var codes = {};
+    if (db && db.db && SQL._sqlite3_errcode) {
+        codes.code = SQL.cwrap('sqlite3_errcode', 'number', ['number'])(db.db);
+        if (SQL._sqlite3_extended_errcode) {
+            codes.extendedCode = SQL.cwrap('sqlite3_extended_errcode', 'number', ['number'])(db.db);
+        }
+    }
+    return codes;
+}
+
+function database() {
+    if (db === null) {
+        throw new Error('database is not open');
+    }
+    return db;
+}
+
+function handle(SQL, msg) {
+    switch (msg.action) {
+    case 'open':
+        if (db !== null) {
+            db.close();
+        }
+        db = msg.buffer ? new SQL.Database(msg.buffer) : new SQL.Database();
+        return { ready: true };
+    case 'exec':
+        var results = database().exec(msg.sql, null, config);
+        return { results: results, rowsModified: db.getRowsModified() };
+    case 'run':
+        database().run(msg.sql, msg.params);
+        return { rowsModified: db.getRowsModified() };
+    case 'query':
+        var stmt = database().prepare(msg.sql);
+        try {
+            if (msg.params) {
+                stmt.bind(msg.params);
+            }
+            var values = [];
+            while (stmt.step()) {
+                values.push(stmt.get(null, config));
+            }
+            return { columns: stmt.getColumnNames(), values: values, rowsModified: db.getRowsModified() };
+        } finally {
+            stmt.free();
+        }
+    case 'export':
+        var buffer = database().export();
+        return { buffer: buffer };
+    case 'close':
+        if (db !== null) {
+            db.close();
+            db = null;
+        }
+        return {};
+    }
+    throw new Error('unknown action: ' + msg.action);
+}
+
+function onMessage(msg) {
+    ready.then(function(SQL) {
+        var reply;
+        try {
+            reply = handle(SQL, msg);
+        } catch (e) {
+            reply = errorCodes(SQL);
+            reply.error = e && e.message !== undefined ? e.message : String(e);
+        }
+        reply.id = msg.id;
+        port.postMessage(reply);
+    }, function(e) {
+        port.postMessage({ id: msg.id, error: 'cannot load sql.js: ' + (e && e.message || e) });
+    });
+}
+
+if (isNode) {
+    port.on('message', onMessage);
+} else {
+    port.onmessage = function(event) { onMessage(event.data); };
+}
@@ -0,0 +1,310 @@
+// +build js
+
+// Package worker provides a database/sql driver which runs SQL.js inside a
+// Web Worker, or a node.js worker_threads Worker, so that queries do not
+// block the main JavaScript thread.
+//
+// The worker must run the sqljs-worker.js script found in this directory,
+// which should be served alongside the application in the browser. The
+// driver is registered as "sqljs-worker", and the DSN is the URL (or, under
+// node.js, the file path) of the script:
+//
+//    db, err := sql.Open("sqljs-worker", "/js/sqljs-worker.js?sqljs=/js/sql.js")
+//
+// Each connection starts its own worker, holding a new in-memory database. To
+// use a database read from a file, open it with bindings.OpenWorker(), and
+// pass it to OpenDB().
+//
+// Database calls block the calling goroutine until the worker replies, so they
+// must not be made directly from JavaScript callbacks. A call whose context is
+// cancelled returns at once, but the worker still runs its statement, so the
+// connection is not used again.
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+func init() {
+	sql.Register("sqljs-worker", &Driver{})
+}
+
+// Driver is a database/sql driver whose connections each run in a new
+// worker, started from the script given as the DSN.
+type Driver struct{}
+
+// Open starts a new worker running the script at dsn, and opens a new
+// in-memory database in it.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	if dsn == "" {
+		return nil, errors.New("the DSN must be the URL of sqljs-worker.js")
+	}
+	db, err := bindings.OpenWorker(context.Background(), bindings.NewWorker(dsn), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{db: db}, nil
+}
+
+type connector struct {
+	db *bindings.WorkerDatabase
+}
+
+func (c *connector) Connect(_ context.Context) (driver.Conn, error) {
+	return &conn{db: c.db, borrowed: true}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+// OpenDB returns a *sql.DB which uses the already-open worker database db.
+// The returned *sql.DB uses a single connection. Closing it does not close
+// db.
+func OpenDB(db *bindings.WorkerDatabase) *sql.DB {
+	sqlDB := sql.OpenDB(&connector{db: db})
+	sqlDB.SetMaxOpenConns(1)
+	return sqlDB
+}
+
+type conn struct {
+	db       *bindings.WorkerDatabase
+	borrowed bool // The database belongs to the caller of OpenDB()
+	// bad is set when a call is cancelled while the worker runs its
+	// statement, which leaves the state of the connection unknown.
+	bad bool
+}
+
+var (
+	_ driver.ExecerContext   = &conn{}
+	_ driver.QueryerContext  = &conn{}
+	_ driver.ConnBeginTx     = &conn{}
+	_ driver.SessionResetter = &conn{}
+	_ driver.Validator       = &conn{}
+)
+
+// check marks the connection as bad if err is the error of ctx, which means
+// that the worker may still run the statement after the call has returned.
+func (c *conn) check(ctx context.Context, err error) error {
+	if err != nil && err == ctx.Err() {
+		c.bad = true
+	}
+	return err
+}
+
+func (c *conn) ResetSession(_ context.Context) error {
+	if c.bad {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	return !c.bad
+}
+
+// Prepare returns a statement for query. Statements are not prepared in the
+// worker until they are executed, so syntax errors are reported by Exec and
+// Query.
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	if c.bad {
+		return nil, driver.ErrBadConn
+	}
+	return &stmt{conn: c, query: query}, nil
+}
+
+// Close terminates the worker, unless the database was passed to OpenDB(). In
+// that case, a bad connection rolls back any transaction begun by a cancelled
+// BEGIN, so that it does not carry over to the next connection.
+func (c *conn) Close() error {
+	if c.borrowed {
+		if c.bad {
+			_, _ = c.db.Run(context.Background(), "ROLLBACK")
+		}
+		return nil
+	}
+	return c.db.Close(context.Background())
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.bad {
+		return nil, driver.ErrBadConn
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("read-only transactions are not supported")
+	}
+	if _, err := c.db.Run(ctx, "BEGIN"); err != nil {
+		return nil, c.check(ctx, err)
+	}
+	return &tx{c}, nil
+}
+
+// ExecContext executes query in the worker. Queries without arguments may
+// contain several statements, separated by ';'.
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c.bad {
+		return nil, driver.ErrBadConn
+	}
+	if len(args) == 0 {
+		n, err := c.db.Run(ctx, query)
+		if err != nil {
+			return nil, c.check(ctx, err)
+		}
+		return result(n), nil
+	}
+	params, err := positional(args)
+	if err != nil {
+		return nil, err
+	}
+	n, err := c.db.RunParams(ctx, query, params)
+	if err != nil {
+		return nil, c.check(ctx, err)
+	}
+	return result(n), nil
+}
+
+// QueryContext executes query in the worker, and returns all of its rows.
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.bad {
+		return nil, driver.ErrBadConn
+	}
+	params, err := positional(args)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.db.Query(ctx, query, params)
+	if err != nil {
+		return nil, c.check(ctx, err)
+	}
+	return &rows{Result: r}, nil
+}
+
+// positional converts args to positional parameters for SQL.js.
+func positional(args []driver.NamedValue) ([]interface{}, error) {
+	params := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("named parameters are not supported")
+		}
+		params[i] = arg.Value
+	}
+	return params, nil
+}
+
+type tx struct {
+	conn *conn
+}
+
+// Commit commits the transaction. If a statement of the transaction was
+// cancelled, which may or may not have taken effect, it is rolled back
+// instead.
+func (t *tx) Commit() error {
+	if t.conn.bad {
+		t.Rollback()
+		return driver.ErrBadConn
+	}
+	_, err := t.conn.db.Run(context.Background(), "COMMIT")
+	return err
+}
+
+func (t *tx) Rollback() error {
+	_, err := t.conn.db.Run(context.Background(), "ROLLBACK")
+	return err
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput returns -1, as the statement is not prepared until it is run.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), named(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if s.conn.bad {
+		return nil, driver.ErrBadConn
+	}
+	params, err := positional(args)
+	if err != nil {
+		return nil, err
+	}
+	n, err := s.conn.db.RunParams(ctx, s.query, params)
+	if err != nil {
+		return nil, s.conn.check(ctx, err)
+	}
+	return result(n), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), named(args))
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return nv
+}
+
+// result is the number of rows affected by a statement.
+type result int64
+
+// LastInsertId is not supported. It will always return an error.
+func (result) LastInsertId() (int64, error) {
+	return 0, errors.New("LastInsertId not available")
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+// rows iterates over the rows returned by the worker, which are all received
+// at once.
+type rows struct {
+	*bindings.Result
+	next int
+}
+
+func (r *rows) Columns() []string {
+	return r.Result.Columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.Values) {
+		return io.EOF
+	}
+	for i := range dest {
+		dest[i] = r.Values[r.next][i]
+	}
+	r.next++
+	return nil
+}
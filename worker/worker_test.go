@@ -0,0 +1,190 @@
+// +build js
+
+package worker
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/flimzy/go-sql.js/bindings"
+)
+
+// script is the path of the worker script, relative to the package directory
+// in which the tests are run by node.js.
+const script = "./sqljs-worker.js"
+
+func TestDriver(t *testing.T) {
+	db, err := sql.Open("sqljs-worker", script)
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, data BLOB); CREATE INDEX t_name ON t (name)"); err != nil {
+		t.Fatalf("Error creating table: %s", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Error beginning transaction: %s", err)
+	}
+	for i, name := range []string{"one", "two", "three"} {
+		if _, err := tx.Exec("INSERT INTO t (id, name, data) VALUES (?, ?, ?)", i+1, name, []byte(name)); err != nil {
+			t.Fatalf("Error inserting: %s", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Error committing: %s", err)
+	}
+
+	res, err := db.Exec("UPDATE t SET name = upper(name) WHERE id > ?", 1)
+	if err != nil {
+		t.Fatalf("Error updating: %s", err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("Expected 2 rows affected, got %d", n)
+	}
+
+	rows, err := db.Query("SELECT id, name, data FROM t WHERE id >= ? ORDER BY id", 2)
+	if err != nil {
+		t.Fatalf("Error querying: %s", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var id int64
+		var name string
+		var data []byte
+		if err := rows.Scan(&id, &name, &data); err != nil {
+			t.Fatalf("Error scanning: %s", err)
+		}
+		if string(data) != map[int64]string{2: "two", 3: "three"}[id] {
+			t.Errorf("Unexpected data for row %d: %q", id, data)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Error iterating: %s", err)
+	}
+	if len(names) != 2 || names[0] != "TWO" || names[1] != "THREE" {
+		t.Errorf("Unexpected names: %v", names)
+	}
+
+	var big int64
+	if err := db.QueryRow("SELECT 9007199254740993").Scan(&big); err != nil {
+		t.Fatalf("Error selecting large integer: %s", err)
+	}
+	if big != 9007199254740993 {
+		t.Errorf("Expected exact large integer, got %d", big)
+	}
+
+	_, err = db.Exec("INSERT INTO t (id) VALUES (1)")
+	if !errors.Is(err, bindings.ErrConstraint) {
+		t.Errorf("Expected constraint error, got %v", err)
+	}
+}
+
+func TestWorkerDatabase(t *testing.T) {
+	ctx := context.Background()
+	src, err := bindings.OpenWorker(ctx, bindings.NewWorker(script), nil)
+	if err != nil {
+		t.Fatalf("Error opening worker: %s", err)
+	}
+	if n, err := src.Run(ctx, "CREATE TABLE t (x); INSERT INTO t VALUES (1), (2)"); err != nil || n != 2 {
+		t.Fatalf("Error creating table: %d rows modified, %v", n, err)
+	}
+	export, err := src.Export(ctx)
+	if err != nil {
+		t.Fatalf("Error exporting: %s", err)
+	}
+	if err := src.Close(ctx); err != nil {
+		t.Fatalf("Error closing: %s", err)
+	}
+	if _, _, err := src.Exec(ctx, "SELECT 1"); err != bindings.ErrWorkerClosed {
+		t.Errorf("Expected ErrWorkerClosed, got %v", err)
+	}
+
+	data, _ := ioutil.ReadAll(export)
+	wdb, err := bindings.OpenWorker(ctx, bindings.NewWorker(script), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Error opening exported database: %s", err)
+	}
+	defer wdb.Close(ctx)
+
+	results, _, err := wdb.Exec(ctx, "SELECT sum(x) AS total FROM t; SELECT count(*) FROM t")
+	if err != nil {
+		t.Fatalf("Error executing: %s", err)
+	}
+	if len(results) != 2 || results[0].Columns[0] != "total" || results[0].Values[0][0] != int64(3) {
+		t.Errorf("Unexpected results: %v", results)
+	}
+
+	_, err = wdb.Query(ctx, "SELECT * FROM missing", nil)
+	var e *bindings.Error
+	if !errors.As(err, &e) || e.SQL != "SELECT * FROM missing" || !errors.Is(err, bindings.ErrError) {
+		t.Errorf("Unexpected error: %#v", err)
+	}
+
+	db := OpenDB(wdb)
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM t WHERE x > ?", 1).Scan(&n); err != nil || n != 1 {
+		t.Errorf("Unexpected count %d: %v", n, err)
+	}
+	if res, err := db.Exec("UPDATE t SET x = x + 1 WHERE x > ?", 0); err != nil {
+		t.Errorf("Error updating: %s", err)
+	} else if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("Expected 2 rows affected, got %d", n)
+	}
+	db.Close()
+	if _, _, err := wdb.Exec(ctx, "SELECT 1"); err != nil {
+		t.Errorf("Closing the *sql.DB closed the worker database: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := wdb.Exec(ctx, "SELECT 1"); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCancelBegin(t *testing.T) {
+	db, err := sql.Open("sqljs-worker", script)
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Error getting connection: %s", err)
+	}
+	// database/sql does not call the driver with a context which is
+	// already cancelled, so BeginTx is called directly.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = c.Raw(func(dc interface{}) error {
+		_, err := dc.(*conn).BeginTx(ctx, driver.TxOptions{})
+		return err
+	})
+	if err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := c.BeginTx(context.Background(), nil); !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("Expected driver.ErrBadConn, got %v", err)
+	}
+	c.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Error beginning transaction after a cancelled BEGIN: %s", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Errorf("Error rolling back: %s", err)
+	}
+}